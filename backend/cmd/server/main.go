@@ -2,10 +2,13 @@ package main
 
 import (
 	"chat-app/internal/handler"
+	"chat-app/internal/hub"
 	"chat-app/internal/infra"
 	"chat-app/internal/repository"
 	"chat-app/internal/router"
 	"chat-app/internal/service"
+	"context"
+	"log"
 	"os"
 
 	"github.com/joho/godotenv"
@@ -31,24 +34,50 @@ func main() {
 
 	redisClient := infra.NewRedisClient()
 
+	// ルームのイベントは Redis 経由で全インスタンスへ配信
+	roomHub := hub.New(redisClient)
+	if err := roomHub.Start(context.Background()); err != nil {
+		panic("failed to subscribe room events")
+	}
+
 	userRepo := repository.NewUserRepository(db)
 	userService := service.NewUserService(db, userRepo)
-	userHandler := handler.NewUserHandler(userService)
+	userHandler := handler.NewUserHandler(userService, redisClient)
 	authRepo := repository.NewUserRepository(db)
 	authService := service.NewAuthService(authRepo)
 	authHandler := handler.NewAuthHandler(authService)
 	roomRepo := repository.NewRoomRepository(db)
 	roomService := service.NewRoomService(roomRepo, userRepo)
-	roomHandler := handler.NewRoomHandler(roomService, userService)
+	roomHandler := handler.NewRoomHandler(roomService, userService, redisClient, roomHub)
 	msgRepo := repository.NewMessageRepository(db)
-	msgHandler := handler.NewMessageHandler(msgRepo, roomService)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	store := infra.NewStorage()
+	msgService := service.NewMessageService(msgRepo, roomRepo, attachmentRepo, store)
+	msgHandler := handler.NewMessageHandler(msgRepo, msgService, roomService, redisClient, roomHub)
 	// ✅ Redis対応済みの NotifyWSHandler
-	wsNotifyHandler := handler.NewNotifyWSHandler(redisClient)
+	wsNotifyHandler := handler.NewNotifyWSHandler(redisClient, roomService)
 	// ✅ Redis対応済みの WebSocketHandler
-	wsHandler := handler.NewWebSocketHandler(msgRepo, roomService, wsNotifyHandler, redisClient)
+	wsHandler := handler.NewWebSocketHandler(msgRepo, msgService, roomService, wsNotifyHandler, redisClient, roomHub)
+	attachmentService := service.NewAttachmentService(attachmentRepo, roomRepo, store)
+	attachmentHandler := handler.NewAttachmentHandler(attachmentService)
+	inviteRepo := repository.NewInviteRepository(db)
+	inviteService := service.NewInviteService(inviteRepo, roomRepo, roomService)
+	inviteHandler := handler.NewInviteHandler(inviteService, roomService, redisClient, roomHub)
+	channelHandler := handler.NewChannelHandler(roomService, redisClient, roomHub)
 
+	// 落ちたインスタンスに接続していたユーザーもオフラインとして通知する
+	handler.StartPresenceSweeper(context.Background(), redisClient, roomService)
+
+	// メトリクスは内部のアドレス（例: 127.0.0.1:9090）を指定したときだけ公開する
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		go func() {
+			if err := router.SetupMetricsRouter().Run(addr); err != nil {
+				log.Println("メトリクスの待ち受け失敗:", err)
+			}
+		}()
+	}
 
-	r := router.SetupRouter(userHandler, authHandler, roomHandler, msgHandler, wsHandler, wsNotifyHandler)
+	r := router.SetupRouter(userHandler, authHandler, roomHandler, msgHandler, wsHandler, wsNotifyHandler, attachmentHandler, inviteHandler, channelHandler)
 
 	r.Run(":" + os.Getenv("PORT"))
 }
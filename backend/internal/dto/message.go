@@ -0,0 +1,70 @@
+package dto
+
+import (
+	"chat-app/internal/model"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// メンション一覧の1件
+type MentionItem struct {
+	model.Message
+	RoomName   string `json:"room_name"`
+	IsGroup    bool   `json:"is_group"`
+	MentionAll bool   `json:"mention_all"`
+}
+
+// メッセージ検索の条件
+type SearchParams struct {
+	Query    string
+	RoomID   *uuid.UUID
+	SenderID *uint
+	From     *time.Time // この日時以降
+	To       *time.Time // この日時より前
+	Cursor   *SearchCursor
+	Limit    int
+}
+
+// 検索結果のページ位置（最後に返した結果）
+type SearchCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// 検索結果の1件（snippet は HTML エスケープ済みで一致箇所を <mark> で囲む）
+type SearchResult struct {
+	MessageID uint      `json:"message_id"`
+	RoomID    uuid.UUID `json:"room_id"`
+	RoomName  string    `json:"room_name"`
+	IsGroup   bool      `json:"is_group"`
+	ParentID  *uint     `json:"parent_id"`
+	SenderID  uint      `json:"sender_id"`
+	Sender    string    `json:"sender"`
+	Snippet   string    `json:"snippet"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SearchResponse struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor string         `json:"next_cursor,omitempty"` // 続きがなければ空
+}
+
+// メッセージを既読にしたメンバー
+type SeenBy struct {
+	UserID uint   `json:"user_id"`
+	Name   string `json:"name"`
+	// 既読位置を最後に動かした時刻（このメッセージを読んだ時刻ではない。後のメッセージまで読めば更新される）
+	LastReadAt time.Time `json:"last_read_at"`
+}
+
+// ピン留めしたメッセージ
+type PinnedMessage struct {
+	MessageID uint      `json:"message_id"`
+	SenderID  uint      `json:"sender_id"`
+	Sender    string    `json:"sender"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	PinnedBy  uint      `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+}
@@ -6,7 +6,42 @@ type RoomWithUnread struct {
   RoomID        string    `json:"room_id"`
   DisplayName   string    `json:"display_name"`
   IsGroup       bool      `json:"is_group"`
+  Role          string    `json:"role"` // 自分の役割（owner / admin / member）
+  Visibility    string    `json:"visibility"` // private / public
+  Topic         string    `json:"topic"`
   LastMessage   string    `json:"last_message"`
   LastMessageAt time.Time `json:"last_message_at"`
   UnreadCount   int       `json:"unread_count"`
+  MentionCount  int       `json:"mention_count"` // 未読のうち自分宛てのメンション数
+  LastReadMessageID *uint `json:"last_read_message_id"` // 既読位置（未読がなければ null）
+  NotifyLevel   string     `json:"notify_level"` // all / mentions / muted
+  MutedUntil    *time.Time `json:"muted_until"`  // 期限付きミュートの終了時刻
+}
+
+// 参加前に表示する招待の内容
+type InvitePreview struct {
+  RoomID      string     `json:"room_id"`
+  DisplayName string     `json:"display_name"`
+  MemberCount int        `json:"member_count"`
+  ExpiresAt   *time.Time `json:"expires_at"`
+  IsMember    bool       `json:"is_member"` // 既に参加している
+}
+
+// 招待リンクから参加したユーザー
+type InviteUse struct {
+  InviteID uint      `json:"invite_id"`
+  UserID   uint      `json:"user_id"`
+  Name     string    `json:"name"`
+  JoinedAt time.Time `json:"joined_at"`
+}
+
+// チャンネル一覧の1件
+type ChannelSummary struct {
+  RoomID      string    `json:"room_id"`
+  DisplayName string    `json:"display_name"`
+  Topic       string    `json:"topic"`
+  Description string    `json:"description"`
+  MemberCount int       `json:"member_count"`
+  IsMember    bool      `json:"is_member"`
+  CreatedAt   time.Time `json:"created_at"`
 }
@@ -1,6 +1,13 @@
 package dto
 
+import "time"
+
 type UserSummary struct {
 	ID   uint   `json:"id"`
 	Name string `json:"name"`
+	Role string `json:"role,omitempty"` // ルームメンバーとして取得した場合のみ（owner / admin / member）
+
+	// オンライン状態（online / away / offline）
+	Presence   string     `json:"presence,omitempty" gorm:"-"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty" gorm:"-"`
 }
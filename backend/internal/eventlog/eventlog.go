@@ -0,0 +1,165 @@
+package eventlog
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 再接続時に取りこぼしたイベントを再送するためのログ（Redis Streams）
+// イベントIDはストリームのエントリID（"<ミリ秒>-<連番>"）で、単調増加する
+const (
+	// 1ストリームに残す件数（おおよそ）
+	maxLen = 1000
+	// 最後のイベントからこの時間でログごと消える
+	retention = 24 * time.Hour
+	// 1回の再接続で再送する上限（超える場合は再取得してもらう）
+	MaxReplay = 200
+
+	dataField = "data"
+)
+
+// ログが切り詰められていて、指定のイベント以降を再送できない
+var ErrTooFarBehind = errors.New("event log has been trimmed")
+
+var ErrInvalidID = errors.New("invalid event id")
+
+type Entry struct {
+	ID   string
+	Data string
+}
+
+// イベントを追記して、採番されたIDを返す
+func Append(ctx context.Context, rdb *redis.Client, key string, data []byte) (string, error) {
+	id, err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: maxLen,
+		Approx: true,
+		Values: map[string]interface{}{dataField: data},
+	}).Result()
+	if err != nil {
+		return "", err
+	}
+	rdb.Expire(ctx, key, retention)
+	return id, nil
+}
+
+// since より後のイベントを古い順に返す
+// since 以前のログが消えている場合や件数が多すぎる場合は ErrTooFarBehind
+func Since(ctx context.Context, rdb *redis.Client, key string, since string) ([]Entry, error) {
+	if _, _, err := parseID(since); err != nil {
+		return nil, err
+	}
+
+	first, err := rdb.XRangeN(ctx, key, "-", "+", 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	// ログが空（期限切れ）か、since 直後のイベントが消えている可能性がある
+	if len(first) == 0 || Compare(since, first[0].ID) < 0 {
+		return nil, ErrTooFarBehind
+	}
+
+	messages, err := rdb.XRangeN(ctx, key, "("+since, "+", MaxReplay+1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > MaxReplay {
+		return nil, ErrTooFarBehind
+	}
+	return toEntries(messages), nil
+}
+
+// since より後のイベントを古い順に最大 count 件返す（since が空なら先頭から）
+// Since と違い、ログの切り詰めは確認しない（直前に確認済みの位置から読み進める用）
+func After(ctx context.Context, rdb *redis.Client, key string, since string, count int64) ([]Entry, error) {
+	start := "-"
+	if since != "" {
+		if _, _, err := parseID(since); err != nil {
+			return nil, err
+		}
+		start = "(" + since
+	}
+	messages, err := rdb.XRangeN(ctx, key, start, "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	return toEntries(messages), nil
+}
+
+func toEntries(messages []redis.XMessage) []Entry {
+	entries := make([]Entry, 0, len(messages))
+	for _, m := range messages {
+		data, _ := m.Values[dataField].(string)
+		entries = append(entries, Entry{ID: m.ID, Data: data})
+	}
+	return entries
+}
+
+// イベントIDの形式チェック
+func Validate(id string) error {
+	_, _, err := parseID(id)
+	return err
+}
+
+// イベントIDの比較（a < b なら負、a == b なら 0、a > b なら正）
+func Compare(a, b string) int {
+	ams, aseq, _ := parseID(a)
+	bms, bseq, _ := parseID(b)
+	switch {
+	case ams != bms:
+		if ams < bms {
+			return -1
+		}
+		return 1
+	case aseq != bseq:
+		if aseq < bseq {
+			return -1
+		}
+		return 1
+	default:
+		return 0
+	}
+}
+
+func parseID(id string) (uint64, uint64, error) {
+	msPart, seqPart, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, ErrInvalidID
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidID
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidID
+	}
+	return ms, seq, nil
+}
+
+// 指定のイベントの内容（ログにないなら空文字）
+func Get(ctx context.Context, rdb *redis.Client, key string, id string) (string, error) {
+	if _, _, err := parseID(id); err != nil {
+		return "", err
+	}
+	messages, err := rdb.XRangeN(ctx, key, id, id, 1).Result()
+	if err != nil || len(messages) == 0 {
+		return "", err
+	}
+	data, _ := messages[0].Values[dataField].(string)
+	return data, nil
+}
+
+// 最新のイベントID（ログが空なら空文字）
+func Latest(ctx context.Context, rdb *redis.Client, key string) (string, error) {
+	messages, err := rdb.XRevRangeN(ctx, key, "+", "-", 1).Result()
+	if err != nil || len(messages) == 0 {
+		return "", err
+	}
+	return messages[0].ID, nil
+}
@@ -0,0 +1,158 @@
+package eventlog_test
+
+import (
+	"chat-app/internal/eventlog"
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1700000000000-0", "1700000000000-0", 0},
+		{"1700000000000-0", "1700000000001-0", -1},
+		{"1700000000001-0", "1700000000000-5", 1},
+		// 同じミリ秒なら連番で比べる（文字列の比較では "10" < "9" になる）
+		{"1700000000000-9", "1700000000000-10", -1},
+		{"1700000000000-10", "1700000000000-9", 1},
+		// 桁数の違うミリ秒
+		{"999-0", "1000-0", -1},
+	}
+	for _, tt := range tests {
+		if got := eventlog.Compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []string{"0-0", "1700000000000-0", "1700000000000-12"}
+	for _, id := range valid {
+		if err := eventlog.Validate(id); err != nil {
+			t.Errorf("Validate(%q) = %v, want nil", id, err)
+		}
+	}
+
+	invalid := []string{"", "-", "1700000000000", "1700000000000-", "-1", "abc-0", "1-abc", "1-2-3", "-1-0", "1.5-0", " 1-0", "$", "+"}
+	for _, id := range invalid {
+		if err := eventlog.Validate(id); !errors.Is(err, eventlog.ErrInvalidID) {
+			t.Errorf("Validate(%q) = %v, want ErrInvalidID", id, err)
+		}
+	}
+}
+
+// ローカルの Redis（REDIS_URL、なければ localhost:6379）に接続できなければスキップ
+func newRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		url = "redis://localhost:6379/0"
+	}
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		t.Skipf("invalid REDIS_URL: %v", err)
+	}
+	rdb := redis.NewClient(opt)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		t.Skipf("redis is not available: %v", err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// テスト用のログにイベントを n 件追記し、そのIDを返す（終了時に削除）
+func appendEvents(t *testing.T, rdb *redis.Client, key string, n int) []string {
+	t.Helper()
+	ctx := context.Background()
+	t.Cleanup(func() { rdb.Del(ctx, key) })
+
+	ids := make([]string, n)
+	for i := range ids {
+		id, err := eventlog.Append(ctx, rdb, key, []byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+// since より後のイベントだけを古い順に返す
+func TestSinceReturnsLaterEntries(t *testing.T) {
+	rdb := newRedis(t)
+	ctx := context.Background()
+	key := "test:eventlog:" + uuid.NewString()
+	ids := appendEvents(t, rdb, key, 5)
+
+	entries, err := eventlog.Since(ctx, rdb, key, ids[1])
+	if err != nil {
+		t.Fatalf("since: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	for i, e := range entries {
+		if e.ID != ids[i+2] || e.Data != strconv.Itoa(i+2) {
+			t.Errorf("entry %d = %+v, want id %s data %d", i, e, ids[i+2], i+2)
+		}
+	}
+
+	// 最新まで受け取っていれば空
+	entries, err = eventlog.Since(ctx, rdb, key, ids[4])
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("since latest = %+v, %v", entries, err)
+	}
+	if _, err := eventlog.Since(ctx, rdb, key, "latest"); !errors.Is(err, eventlog.ErrInvalidID) {
+		t.Fatalf("since invalid: err = %v, want ErrInvalidID", err)
+	}
+}
+
+// since 直後のイベントがログから消えていれば ErrTooFarBehind
+func TestSinceTrimmedLog(t *testing.T) {
+	rdb := newRedis(t)
+	ctx := context.Background()
+	key := "test:eventlog:" + uuid.NewString()
+	ids := appendEvents(t, rdb, key, 3)
+
+	if err := rdb.XTrimMinID(ctx, key, ids[2]).Err(); err != nil {
+		t.Fatalf("trim: %v", err)
+	}
+	if _, err := eventlog.Since(ctx, rdb, key, ids[0]); !errors.Is(err, eventlog.ErrTooFarBehind) {
+		t.Fatalf("since trimmed: err = %v, want ErrTooFarBehind", err)
+	}
+	// ログごと消えていても同じ
+	if _, err := eventlog.Since(ctx, rdb, "test:eventlog:"+uuid.NewString(), ids[0]); !errors.Is(err, eventlog.ErrTooFarBehind) {
+		t.Fatalf("since missing log: err = %v, want ErrTooFarBehind", err)
+	}
+}
+
+// 再送が MaxReplay 件を超えるなら ErrTooFarBehind（ちょうどなら返す）
+func TestSinceTooManyEntries(t *testing.T) {
+	rdb := newRedis(t)
+	ctx := context.Background()
+	key := "test:eventlog:" + uuid.NewString()
+	ids := appendEvents(t, rdb, key, eventlog.MaxReplay+2)
+
+	if _, err := eventlog.Since(ctx, rdb, key, ids[0]); !errors.Is(err, eventlog.ErrTooFarBehind) {
+		t.Fatalf("since first: err = %v, want ErrTooFarBehind", err)
+	}
+	entries, err := eventlog.Since(ctx, rdb, key, ids[1])
+	if err != nil {
+		t.Fatalf("since second: %v", err)
+	}
+	if len(entries) != eventlog.MaxReplay {
+		t.Fatalf("got %d entries, want %d", len(entries), eventlog.MaxReplay)
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"chat-app/internal/service"
+	"chat-app/internal/util"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AttachmentHandler struct {
+	AttachmentService *service.AttachmentService
+}
+
+func NewAttachmentHandler(attachmentService *service.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{AttachmentService: attachmentService}
+}
+
+// 添付ファイルのアップロード（送信前の添付として登録）
+func (h *AttachmentHandler) Upload(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+		return
+	}
+
+	// multipart のオーバーヘッド分だけ余裕を持たせて上限を設定
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.MaxUploadBytes()+1<<20)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrFileTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing file"})
+		return
+	}
+
+	attachment, err := h.AttachmentService.Upload(c.Request.Context(), userID, roomID, fh)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRoomAccessDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
+		case errors.Is(err, service.ErrFileTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrFileTypeNotAllowed):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload file"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment)
+}
+
+// 添付ファイル情報と署名付きダウンロードURLの取得
+func (h *AttachmentHandler) Get(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment id"})
+		return
+	}
+
+	attachment, err := h.AttachmentService.GetForUser(userID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAttachmentNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrRoomAccessDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch attachment"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment)
+}
+
+// 署名付きURLからのダウンロード（<img src> から使えるよう JWT は不要）
+func (h *AttachmentHandler) Download(c *gin.Context) {
+	idStr := c.Param("id")
+	variant := c.DefaultQuery("variant", "original")
+	if !util.VerifyFileSignature(idStr, variant, c.Query("exp"), c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid or expired link"})
+		return
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment id"})
+		return
+	}
+
+	rc, attachment, contentType, err := h.AttachmentService.Open(c.Request.Context(), id, variant)
+	if err != nil {
+		if errors.Is(err, service.ErrAttachmentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+		return
+	}
+	defer rc.Close()
+
+	// 画像はインライン表示、それ以外はダウンロード
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=900")
+	if variant == "original" {
+		c.Header("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, rc)
+}
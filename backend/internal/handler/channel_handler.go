@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"chat-app/internal/hub"
+	"chat-app/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// 公開チャンネル（一覧・作成・参加・退出）
+type ChannelHandler struct {
+	RoomService *service.RoomService
+	RedisClient *redis.Client
+	Hub         *hub.Hub
+}
+
+func NewChannelHandler(roomService *service.RoomService, redisClient *redis.Client, roomHub *hub.Hub) *ChannelHandler {
+	return &ChannelHandler{
+		RoomService: roomService,
+		RedisClient: redisClient,
+		Hub:         roomHub,
+	}
+}
+
+type channelInfoRequest struct {
+	DisplayName string `json:"display_name"`
+	Topic       string `json:"topic"`
+	Description string `json:"description"`
+}
+
+// 公開チャンネルの一覧（?q= で検索、?limit= ?offset= でページング）
+func (h *ChannelHandler) ListChannels(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	channels, err := h.RoomService.ListChannels(userID, c.Query("q"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get channels"})
+		return
+	}
+
+	c.JSON(http.StatusOK, channels)
+}
+
+// 公開チャンネルを作成
+func (h *ChannelHandler) CreateChannel(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	var req channelInfoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	room, err := h.RoomService.CreateChannel(userID, req.DisplayName, req.Topic, req.Description)
+	if err != nil {
+		respondChannelError(c, err, "failed to create channel")
+		return
+	}
+
+	c.JSON(http.StatusCreated, room)
+}
+
+// 公開チャンネルに参加
+func (h *ChannelHandler) JoinChannel(c *gin.Context) {
+	userIDAny, idExists := c.Get("user_id")
+	userNameAny, nameExists := c.Get("user_name")
+	if !idExists || !nameExists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+	userName := userNameAny.(string)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+
+	change, err := h.RoomService.JoinChannel(userID, userName, roomID)
+	if err != nil {
+		respondChannelError(c, err, "failed to join channel")
+		return
+	}
+	publishMembershipChange(h.RedisClient, h.Hub, h.RoomService, "member_added", change)
+
+	c.JSON(http.StatusOK, gin.H{"room_id": change.RoomID})
+}
+
+// 公開チャンネルから退出
+func (h *ChannelHandler) LeaveChannel(c *gin.Context) {
+	userIDAny, idExists := c.Get("user_id")
+	userNameAny, nameExists := c.Get("user_name")
+	if !idExists || !nameExists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+	userName := userNameAny.(string)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+
+	change, promoted, err := h.RoomService.LeaveChannel(userID, userName, roomID)
+	if err != nil {
+		respondChannelError(c, err, "failed to leave channel")
+		return
+	}
+	publishMembershipChange(h.RedisClient, h.Hub, h.RoomService, "member_removed", change)
+	if promoted != nil {
+		broadcastEvent(h.Hub, promoted.RoomID, "role_changed", promoted)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// チャンネルのトピックと説明を変更
+func (h *ChannelHandler) UpdateChannelInfo(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	var req channelInfoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	room, err := h.RoomService.UpdateChannelInfo(userID, roomID, req.Topic, req.Description)
+	if err != nil {
+		respondChannelError(c, err, "failed to update channel")
+		return
+	}
+	broadcastEvent(h.Hub, room.ID.String(), "room_updated", gin.H{
+		"room_id":     room.ID,
+		"topic":       room.Topic,
+		"description": room.Description,
+	})
+
+	c.JSON(http.StatusOK, room)
+}
+
+// チャンネルのエラーをHTTPレスポンスに変換（ルーム権限のエラーは respondRoomError と同じ）
+func respondChannelError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidChannel):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotPublicChannel):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondRoomError(c, err, fallback)
+	}
+}
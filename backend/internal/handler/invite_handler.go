@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"chat-app/internal/hub"
+	"chat-app/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+type InviteHandler struct {
+	InviteService *service.InviteService
+	RoomService   *service.RoomService
+	RedisClient   *redis.Client
+	Hub           *hub.Hub
+}
+
+func NewInviteHandler(inviteService *service.InviteService, roomService *service.RoomService, redisClient *redis.Client, roomHub *hub.Hub) *InviteHandler {
+	return &InviteHandler{
+		InviteService: inviteService,
+		RoomService:   roomService,
+		RedisClient:   redisClient,
+		Hub:           roomHub,
+	}
+}
+
+// 招待リンクを発行
+func (h *InviteHandler) CreateInvite(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	var params service.CreateInviteParams
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+	}
+
+	invite, err := h.InviteService.CreateInvite(userID, roomID, params)
+	if err != nil {
+		respondInviteError(c, err, "failed to create invite")
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+// ルームの招待一覧
+func (h *InviteHandler) ListInvites(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+
+	invites, err := h.InviteService.ListInvites(userID, roomID)
+	if err != nil {
+		respondInviteError(c, err, "failed to get invites")
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// 招待を取り消す
+func (h *InviteHandler) RevokeInvite(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	inviteID, err := strconv.ParseUint(c.Param("invite_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invite id"})
+		return
+	}
+
+	if err := h.InviteService.RevokeInvite(userID, roomID, uint(inviteID)); err != nil {
+		respondInviteError(c, err, "failed to revoke invite")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+// 招待から参加したユーザー
+func (h *InviteHandler) ListInviteUses(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	inviteID, err := strconv.ParseUint(c.Param("invite_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invite id"})
+		return
+	}
+
+	uses, err := h.InviteService.ListInviteUses(userID, roomID, uint(inviteID))
+	if err != nil {
+		respondInviteError(c, err, "failed to get invite uses")
+		return
+	}
+
+	c.JSON(http.StatusOK, uses)
+}
+
+// 参加前の確認
+func (h *InviteHandler) Preview(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	preview, err := h.InviteService.Preview(userID, c.Param("token"))
+	if err != nil {
+		respondInviteError(c, err, "failed to get invite")
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// 招待で参加
+func (h *InviteHandler) Accept(c *gin.Context) {
+	userIDAny, idExists := c.Get("user_id")
+	userNameAny, nameExists := c.Get("user_name")
+	if !idExists || !nameExists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+	userName := userNameAny.(string)
+
+	change, err := h.InviteService.Accept(userID, userName, c.Param("token"))
+	if err != nil {
+		respondInviteError(c, err, "failed to accept invite")
+		return
+	}
+	publishMembershipChange(h.RedisClient, h.Hub, h.RoomService, "member_added", change)
+
+	c.JSON(http.StatusOK, gin.H{"room_id": change.RoomID})
+}
+
+// 招待のエラーをHTTPレスポンスに変換（ルーム権限のエラーは respondRoomError と同じ）
+func respondInviteError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidInvite):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInviteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInviteUnavailable):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
+		respondRoomError(c, err, fallback)
+	}
+}
@@ -1,24 +1,36 @@
 package handler
 
 import (
+	"chat-app/internal/dto"
+	"chat-app/internal/hub"
+	"chat-app/internal/model"
 	"chat-app/internal/repository"
 	"chat-app/internal/service"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
 type MessageHandler struct {
-	MessageRepo *repository.MessageRepository
-	RoomService *service.RoomService
+	MessageRepo    *repository.MessageRepository
+	MessageService *service.MessageService
+	RoomService    *service.RoomService
+	RedisClient    *redis.Client
+	Hub            *hub.Hub
 }
 
-func NewMessageHandler(messageRepo *repository.MessageRepository, roomService *service.RoomService) *MessageHandler {
+func NewMessageHandler(messageRepo *repository.MessageRepository, messageService *service.MessageService, roomService *service.RoomService, redisClient *redis.Client, roomHub *hub.Hub) *MessageHandler {
 	return &MessageHandler{
-		MessageRepo: messageRepo,
-		RoomService: roomService,
+		MessageRepo:    messageRepo,
+		MessageService: messageService,
+		RoomService:    roomService,
+		RedisClient:    redisClient,
+		Hub:            roomHub,
 	}
 }
 
@@ -49,11 +61,455 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 	limit, _ := strconv.Atoi(limitStr)
 
 	// メッセージ取得
-	messages, err := h.MessageRepo.GetMessagesBefore(roomID, before, limit)
+	messages, err := h.MessageRepo.GetMessagesBefore(roomID, userID, before, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch messages"})
 		return
 	}
 
+	// リアクション集計とメンションを付与
+	if err := h.MessageRepo.AttachDetails(messages, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch message details"})
+		return
+	}
+
+	// 1対1ルームは配信状況（sent / delivered / read）を付与
+	oneToOne, err := h.RoomService.IsOneToOne(roomIDStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch message details"})
+		return
+	}
+	if oneToOne {
+		model.SetDeliveryStatus(messages)
+	}
+
 	c.JSON(http.StatusOK, messages)
 }
+
+// 自分宛てのメンション一覧
+func (h *MessageHandler) ListMentions(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	// クエリパラメータ
+	before := c.Query("before")
+	limitStr := c.DefaultQuery("limit", "30")
+	limit, _ := strconv.Atoi(limitStr)
+
+	items, err := h.MessageService.GetMentions(userID, c.GetString("user_name"), before, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch mentions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// メッセージ検索
+// GET /search?q=&room_id=&sender_id=&from=&to=&cursor=&limit=
+func (h *MessageHandler) Search(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	params := dto.SearchParams{Query: c.Query("q")}
+	params.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if v := c.Query("room_id"); v != "" {
+		roomID, err := uuid.Parse(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+			return
+		}
+		params.RoomID = &roomID
+	}
+	if v := c.Query("sender_id"); v != "" {
+		senderID, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sender_id"})
+			return
+		}
+		id := uint(senderID)
+		params.SenderID = &id
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := parseSearchDate(v, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+			return
+		}
+		params.From = &from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := parseSearchDate(v, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+			return
+		}
+		params.To = &to
+	}
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := service.DecodeSearchCursor(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		params.Cursor = cursor
+	}
+
+	resp, err := h.MessageService.Search(userID, c.GetString("user_name"), params)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSearch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// 検索の日付指定（RFC3339 or YYYY-MM-DD。to の日付指定はその日を含む）
+func parseSearchDate(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	t, err := time.ParseInLocation("2006-01-02", v, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// スレッド取得（親メッセージと返信）
+func (h *MessageHandler) GetThread(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+		return
+	}
+
+	parentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	// クエリパラメータ
+	before := c.Query("before")
+	limitStr := c.DefaultQuery("limit", "30")
+	limit, _ := strconv.Atoi(limitStr)
+
+	parent, replies, err := h.MessageService.GetThread(userID, roomID, uint(parentID), before, limit)
+	if err != nil {
+		respondMessageError(c, err, "failed to fetch thread")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"parent":  parent,
+		"replies": replies,
+	})
+}
+
+// メッセージ編集
+func (h *MessageHandler) EditMessage(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	msg, err := h.MessageService.EditMessage(userID, uint(messageID), req.Content)
+	if err != nil {
+		respondMessageError(c, err, "failed to edit message")
+		return
+	}
+
+	// 接続中のルームメンバーへ編集を通知
+	broadcastEvent(h.Hub, msg.RoomID.String(), "edit", msg)
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// メッセージ送信（WebSocket を使えないクライアント向け。配信は WebSocket からの送信と同じ）
+// 同じ client_id の再送は保存済みのメッセージを 200 で返す
+func (h *MessageHandler) SendMessage(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+	userName := c.GetString("user_name")
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+		return
+	}
+
+	if err := h.RoomService.AuthorizeUser(userID, roomID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req sendPayload
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	msg, duplicate, err := h.MessageService.SendMessage(userID, userName, roomID, service.SendParams{
+		Content:       req.Content,
+		ParentID:      req.ParentID,
+		AttachmentIDs: req.AttachmentIDs,
+		ClientID:      req.ClientID,
+	})
+	if err != nil {
+		respondMessageError(c, err, "failed to send message")
+		return
+	}
+
+	touchPresence(h.RedisClient, h.RoomService, userID)
+
+	status := http.StatusOK
+	if !duplicate {
+		publishNewMessage(h.RedisClient, h.Hub, h.RoomService, h.MessageRepo, msg)
+		status = http.StatusCreated
+	}
+
+	c.JSON(status, sendAck{
+		ID:        msg.ID,
+		ClientID:  msg.ClientID,
+		CreatedAt: msg.CreatedAt,
+		Duplicate: duplicate,
+		Message:   msg,
+	})
+}
+
+// メッセージ削除（全員から）
+func (h *MessageHandler) DeleteMessage(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	msg, lastMessage, err := h.MessageService.DeleteForEveryone(userID, uint(messageID))
+	if err != nil {
+		respondMessageError(c, err, "failed to delete message")
+		return
+	}
+
+	publishMessageDeleted(h.RedisClient, h.Hub, h.RoomService, msg, lastMessage)
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// メッセージ削除（自分だけ）
+func (h *MessageHandler) HideMessage(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	msg, err := h.MessageService.HideForUser(userID, uint(messageID))
+	if err != nil {
+		respondMessageError(c, err, "failed to hide message")
+		return
+	}
+
+	publishMessageHidden(h.RedisClient, userID, msg)
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// リアクション追加
+func (h *MessageHandler) AddReaction(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	var req struct {
+		Emoji string `json:"emoji"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	change, err := h.MessageService.AddReaction(userID, uint(messageID), req.Emoji)
+	if err != nil {
+		respondMessageError(c, err, "failed to add reaction")
+		return
+	}
+
+	if change.Changed {
+		broadcastEvent(h.Hub, change.RoomID.String(), "reaction", change)
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// リアクション削除
+func (h *MessageHandler) RemoveReaction(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	change, err := h.MessageService.RemoveReaction(userID, uint(messageID), c.Param("emoji"))
+	if err != nil {
+		respondMessageError(c, err, "failed to remove reaction")
+		return
+	}
+
+	if change.Changed {
+		broadcastEvent(h.Hub, change.RoomID.String(), "reaction", change)
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// メッセージ編集履歴取得
+func (h *MessageHandler) GetEditHistory(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+		return
+	}
+
+	edits, err := h.MessageService.GetEditHistory(userID, roomID, uint(messageID))
+	if err != nil {
+		respondMessageError(c, err, "failed to fetch edit history")
+		return
+	}
+
+	c.JSON(http.StatusOK, edits)
+}
+
+// メッセージの既読者一覧
+func (h *MessageHandler) GetSeenBy(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+		return
+	}
+
+	seenBy, err := h.MessageService.GetSeenBy(userID, roomID, uint(messageID))
+	if err != nil {
+		respondMessageError(c, err, "failed to fetch read receipts")
+		return
+	}
+
+	c.JSON(http.StatusOK, seenBy)
+}
+
+// サービスのエラーをHTTPレスポンスに変換（想定外のエラーは fallback を返す）
+func respondMessageError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrEmptyContent), errors.Is(err, service.ErrInvalidParent), errors.Is(err, service.ErrInvalidEmoji), errors.Is(err, service.ErrInvalidAttachment), errors.Is(err, service.ErrInvalidClientID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotMessageSender), errors.Is(err, service.ErrRoomAccessDenied), errors.Is(err, service.ErrSystemMessage):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMessageDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"chat-app/internal/eventlog"
+	"chat-app/internal/notify"
+	"chat-app/internal/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebSocket が使えない環境向けの通知の受け取り方
+// 内容は /ws-notify と同じ（user:<id> の通知と event_id）
+
+const (
+	// ロングポーリングの待ち時間（既定・上限）
+	defaultPollTimeout = 25 * time.Second
+	maxPollTimeout     = 60 * time.Second
+	// 1回のポーリングで返す上限
+	maxPollEvents = 100
+	// 最初の通知が届いてから返すまでの待ち時間
+	pollBatchWindow = 50 * time.Millisecond
+)
+
+// Server-Sent Events（EventSource はヘッダーを付けられないのでトークンはクエリで受け取る）
+// 再接続時はブラウザが送る Last-Event-ID（または ?since=）以降を再送する
+func (h *NotifyWSHandler) Stream(c *gin.Context) {
+	tokenStr := c.Query("token")
+	if tokenStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		return
+	}
+
+	userID, _, err := util.ValidateJWTAndExtract(tokenStr)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	since := c.GetHeader("Last-Event-ID")
+	if since == "" {
+		since = c.Query("since")
+	}
+	if since != "" && eventlog.Validate(since) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // プロキシでバッファリングさせない
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	// 無通信で切られないようにコメント行を送る
+	keepalive := func() {
+		fmt.Fprint(c.Writer, ": ping\n\n")
+		c.Writer.Flush()
+	}
+
+	// 接続中はオンライン（切断で解除）
+	go trackPresence(h.RedisClient, h.RoomService, userID, c.Request.Context().Done())
+
+	streamNotifications(h.RedisClient, userID, since, c.Request.Context().Done(), keepalive, func(payload string) bool {
+		if id := notify.EventID(payload); id != "" {
+			fmt.Fprintf(c.Writer, "id: %s\n", id)
+		}
+		fmt.Fprintf(c.Writer, "data: %s\n\n", payload)
+		c.Writer.Flush()
+		return c.Request.Context().Err() == nil
+	})
+}
+
+// 通知の受信確認（SSE・ロングポーリングで受け取った場合）
+// /ws-notify の {"type":"ack","event_id":"..."} と同じ扱い
+func (h *NotifyWSHandler) Ack(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	var req struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || eventlog.Validate(req.EventID) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event_id"})
+		return
+	}
+
+	if err := h.acknowledge(userID, req.EventID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to acknowledge"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ロングポーリング
+// since 以降の通知があればすぐに、なければ届くまで（最大 timeout 秒）待って返す
+// 次回は返された next を since に指定する
+func (h *NotifyWSHandler) Poll(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	since := c.Query("since")
+	if since != "" && eventlog.Validate(since) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+		return
+	}
+
+	timeout := defaultPollTimeout
+	if v := c.Query("timeout"); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timeout"})
+			return
+		}
+		timeout = min(time.Duration(sec)*time.Second, maxPollTimeout)
+	}
+
+	// 初回は現在の最新から待つ
+	if since == "" {
+		latest, err := notify.LatestEventID(h.RedisClient, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get events"})
+			return
+		}
+		since = latest
+	}
+
+	// 取りこぼさないよう、購読してから再送分を確認する
+	ctx := c.Request.Context()
+	pubsub := h.RedisClient.Subscribe(ctx, fmt.Sprintf("user:%d", userID))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to subscribe"})
+		return
+	}
+
+	events := []json.RawMessage{}
+	next := since
+
+	if since != "" {
+		payloads, err := notify.Replay(h.RedisClient, userID, since)
+		if errors.Is(err, eventlog.ErrTooFarBehind) {
+			// 再送できないので、ルーム一覧などを再取得してから next を since にしてもらう
+			latest, _ := notify.LatestEventID(h.RedisClient, userID)
+			c.JSON(http.StatusOK, gin.H{"events": events, "next": latest, "resync_required": true})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get events"})
+			return
+		}
+		for _, p := range payloads {
+			events = append(events, json.RawMessage(p))
+			next = notify.EventID(p)
+		}
+		if len(events) > 0 {
+			c.JSON(http.StatusOK, gin.H{"events": events, "next": next})
+			return
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ch := pubsub.Channel()
+
+	// ライブの通知は届いたことの合図にだけ使い、内容はログから ID 順に読む
+	// （配信順は ID の順と一致しないことがあり、届いた順に next を進めると前の ID を取りこぼす。
+	//   後の ID が届いた時点で、前の ID は必ずログに書かれている）
+	woke := false
+wait:
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				break wait
+			}
+			// 続けて届く分もまとめて返すため、少しだけ待つ
+			if !woke {
+				woke = true
+				timer.Reset(pollBatchWindow)
+			}
+		case <-timer.C:
+			break wait
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if woke {
+		payloads, err := notify.After(h.RedisClient, userID, since, maxPollEvents)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get events"})
+			return
+		}
+		for _, p := range payloads {
+			events = append(events, json.RawMessage(p))
+			next = notify.EventID(p)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events, "next": next})
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"chat-app/internal/notify"
+	"chat-app/internal/presence"
+	"chat-app/internal/service"
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// 接続中はオンラインとして登録し続け、切断（done）で外す
+// 状態が変わったら同じルームのメンバーへ通知する
+func trackPresence(rdb *redis.Client, roomService *service.RoomService, userID uint, done <-chan struct{}) {
+	connID := uuid.New().String()
+
+	p, changed, err := presence.Connect(rdb, userID, connID)
+	reportPresence(rdb, roomService, userID, p, changed, err)
+
+	ticker := time.NewTicker(presence.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p, changed, err := presence.Beat(rdb, userID, connID)
+			reportPresence(rdb, roomService, userID, p, changed, err)
+		case <-done:
+			p, changed, err := presence.Disconnect(rdb, userID, connID)
+			reportPresence(rdb, roomService, userID, p, changed, err)
+			return
+		}
+	}
+}
+
+// 接続の期限切れを定期的に確認し、落ちたインスタンスにいたユーザーのオフラインを通知する
+// ctx が終わるまで続ける
+func StartPresenceSweeper(ctx context.Context, rdb *redis.Client, roomService *service.RoomService) {
+	go func() {
+		ticker := time.NewTicker(presence.Heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				changed, err := presence.Sweep(rdb)
+				if err != nil {
+					log.Println("オンライン状態の確認失敗:", err)
+				}
+				for userID, p := range changed {
+					reportPresence(rdb, roomService, userID, p, true, nil)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// 操作の記録の間隔（離席中の判定には十分短い）
+const activityThrottle = 30 * time.Second
+
+// 接続ごとの操作の記録（受信フレームごとに Redis へ書かないよう間引く）
+// 読み込みゴルーチンからのみ使う
+type activityTracker struct {
+	at time.Time
+}
+
+func (a *activityTracker) touch(rdb *redis.Client, roomService *service.RoomService, userID uint) {
+	now := time.Now()
+	if now.Sub(a.at) < activityThrottle {
+		return
+	}
+	a.at = now
+	touchPresence(rdb, roomService, userID)
+}
+
+// 操作があったことを記録（離席中ならオンラインに戻る）
+func touchPresence(rdb *redis.Client, roomService *service.RoomService, userID uint) {
+	p, changed, err := presence.Touch(rdb, userID)
+	reportPresence(rdb, roomService, userID, p, changed, err)
+}
+
+func reportPresence(rdb *redis.Client, roomService *service.RoomService, userID uint, p presence.Presence, changed bool, err error) {
+	if err != nil {
+		log.Println("オンライン状態の更新失敗:", err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	memberIDs, err := roomService.GetCoMemberIDs(userID)
+	if err != nil {
+		log.Println("メンバー取得失敗:", err)
+		return
+	}
+	for _, id := range memberIDs {
+		notify.PublishToUser(rdb, id, map[string]interface{}{
+			"type":         "presence",
+			"user_id":      userID,
+			"status":       p.Status,
+			"last_seen_at": p.LastSeenAt,
+		})
+	}
+}
+
+// ユーザー一覧にオンライン状態を付与
+func attachPresence(rdb *redis.Client, userIDs []uint, apply func(i int, p presence.Presence)) {
+	states, err := presence.GetMany(rdb, userIDs)
+	if err != nil {
+		log.Println("オンライン状態の取得失敗:", err)
+		return
+	}
+	for i, id := range userIDs {
+		apply(i, states[id])
+	}
+}
@@ -1,29 +1,43 @@
 package handler
 
 import (
+	"chat-app/internal/dto"
+	"chat-app/internal/hub"
+	"chat-app/internal/notify"
+	"chat-app/internal/presence"
 	"chat-app/internal/service"
 	"chat-app/internal/util"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
 type RoomHandler struct {
 	RoomService *service.RoomService
 	UserService *service.UserService
+	RedisClient *redis.Client
+	Hub         *hub.Hub
 }
 
-func NewRoomHandler(roomService *service.RoomService, userService *service.UserService) *RoomHandler {
+func NewRoomHandler(roomService *service.RoomService, userService *service.UserService, redisClient *redis.Client, roomHub *hub.Hub) *RoomHandler {
 	return &RoomHandler{
 		RoomService: roomService,
 		UserService: userService,
+		RedisClient: redisClient,
+		Hub:         roomHub,
 	}
 }
 
 type CreateRoomRequest struct {
 	UserIDs     []uint `json:"user_ids"`
 	DisplayName string `json:"display_name"`
+	// 1対1のみ: 既存の会話があればそれを返す（省略時 true）
+	ReuseExisting *bool `json:"reuse_existing"`
 }
 
 func (h *RoomHandler) CreateRoom(c *gin.Context) {
@@ -42,7 +56,12 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 
 	if len(req.UserIDs) == 1 {
 		targetUserID := req.UserIDs[0]
-		roomID, err := h.RoomService.CreateOneToOneRoomIfNotExists(currentUserID, targetUserID)
+		reuseExisting := req.ReuseExisting == nil || *req.ReuseExisting
+		roomID, err := h.RoomService.CreateOneToOneRoomIfNotExists(currentUserID, targetUserID, reuseExisting)
+		if errors.Is(err, service.ErrRoomExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "room_id": roomID})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create 1:1 room"})
 			return
@@ -51,6 +70,12 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 		return
 	}
 
+	// グループは常に新規作成
+	if req.ReuseExisting != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reuse_existing is only supported for 1:1 rooms"})
+		return
+	}
+
 	displayName := req.DisplayName
 	if displayName == "" {
 		userIDs := append(req.UserIDs, currentUserID)
@@ -62,12 +87,12 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 		displayName = util.JoinNames(names)
 	}
 
-	roomID, err := h.RoomService.CreateGroupRoomIfNotExists(currentUserID, req.UserIDs, displayName)
+	roomID, err := h.RoomService.CreateGroupRoom(currentUserID, req.UserIDs, displayName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create group room"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusCreated, gin.H{
 		"room_id":      roomID,
 		"display_name": displayName,
 	})
@@ -99,13 +124,39 @@ func (h *RoomHandler) MarkRoomAsRead(c *gin.Context) {
 	userID := userIDAny.(uint)
 
 	roomID := c.Param("room_id")
-	err := h.RoomService.MarkAsRead(userID, roomID)
+	parsedUUID, err := uuid.Parse(roomID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	if err := h.RoomService.AuthorizeUser(userID, parsedUUID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// 本文は省略可（省略時は最新メッセージまで既読）
+	var req struct {
+		MessageID uint `json:"message_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+	}
+
+	receipt, err := h.RoomService.MarkAsRead(userID, roomID, req.MessageID)
+	if errors.Is(err, service.ErrInvalidReadPosition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to mark as read"})
 		return
 	}
+	publishReadReceipt(h.RedisClient, h.Hub, receipt)
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "last_read_message_id": receipt.MessageID})
 }
 
 func (h *RoomHandler) UpdateRoomName(c *gin.Context) {
@@ -117,6 +168,10 @@ func (h *RoomHandler) UpdateRoomName(c *gin.Context) {
 	userID := userIDAny.(uint)
 
 	roomID := c.Param("room_id")
+	if _, err := uuid.Parse(roomID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
 	var req struct {
 		DisplayName string `json:"display_name"`
 	}
@@ -127,7 +182,7 @@ func (h *RoomHandler) UpdateRoomName(c *gin.Context) {
 
 	err := h.RoomService.UpdateRoomName(userID, roomID, req.DisplayName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+		respondRoomError(c, err, "update failed")
 		return
 	}
 
@@ -160,6 +215,15 @@ func (h *RoomHandler) GetRoomMembers(c *gin.Context) {
 		return
 	}
 
+	ids := make([]uint, len(members))
+	for i, m := range members {
+		ids[i] = m.ID
+	}
+	attachPresence(h.RedisClient, ids, func(i int, p presence.Presence) {
+		members[i].Presence = p.Status
+		members[i].LastSeenAt = p.LastSeenAt
+	})
+
 	c.JSON(http.StatusOK, members)
 }
 
@@ -170,12 +234,34 @@ func (h *RoomHandler) LeaveRoom(c *gin.Context) {
 		return
 	}
 	userID := userIDAny.(uint)
+	userName := c.GetString("user_name")
 
 	roomID := c.Param("room_id")
-	if err := h.RoomService.LeaveRoom(roomID, userID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to leave room"})
+	if _, err := uuid.Parse(roomID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
 		return
 	}
+	// メンバーでなければ 404（何も通知しない）
+	promoted, err := h.RoomService.LeaveRoom(roomID, userID)
+	if err != nil {
+		respondRoomError(c, err, "failed to leave room")
+		return
+	}
+	// 退会したユーザーのルーム接続（/ws）はこのイベントで切断される
+	broadcastEvent(h.Hub, roomID, "member_removed", &service.MembershipChange{
+		RoomID:  roomID,
+		ActorID: userID,
+		Users:   []dto.UserSummary{{ID: userID, Name: userName}},
+	})
+	// owner が抜けたので、自動で昇格したメンバーを知らせる
+	if promoted != nil {
+		broadcastEvent(h.Hub, roomID, "role_changed", promoted)
+	}
+	// 本人の他の端末にも反映（多重化接続の購読も取り消される）
+	notify.PublishToUser(h.RedisClient, userID, map[string]interface{}{
+		"type":    "room_left",
+		"room_id": roomID,
+	})
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
@@ -198,9 +284,328 @@ func (h *RoomHandler) DeleteRoom(c *gin.Context) {
 		return
 	}
 
-	if err := h.RoomService.DeleteRoom(roomID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// 削除後はメンバーを引けないので先に取得
+	members, err := h.RoomService.GetMembersByRoomID(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get members"})
+		return
+	}
+
+	if err := h.RoomService.DeleteRoom(userID, roomID); err != nil {
+		respondRoomError(c, err, "failed to delete room")
 		return
 	}
+	for _, m := range members {
+		notify.PublishToUser(h.RedisClient, m.ID, map[string]interface{}{
+			"type":    "room_deleted",
+			"room_id": roomID,
+		})
+	}
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
+
+// グループにメンバーを追加
+func (h *RoomHandler) AddMembers(c *gin.Context) {
+	userIDAny, idExists := c.Get("user_id")
+	userNameAny, nameExists := c.Get("user_name")
+	if !idExists || !nameExists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+	userName := userNameAny.(string)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	var req struct {
+		UserIDs []uint `json:"user_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	change, err := h.RoomService.AddMembers(userID, userName, roomID, req.UserIDs)
+	if err != nil {
+		respondRoomError(c, err, "failed to add members")
+		return
+	}
+	publishMembershipChange(h.RedisClient, h.Hub, h.RoomService, "member_added", change)
+
+	c.JSON(http.StatusOK, change)
+}
+
+// グループからメンバーを削除
+func (h *RoomHandler) RemoveMember(c *gin.Context) {
+	userIDAny, idExists := c.Get("user_id")
+	userNameAny, nameExists := c.Get("user_name")
+	if !idExists || !nameExists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+	userName := userNameAny.(string)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	targetID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	change, err := h.RoomService.RemoveMember(userID, userName, roomID, uint(targetID))
+	if err != nil {
+		respondRoomError(c, err, "failed to remove member")
+		return
+	}
+	publishMembershipChange(h.RedisClient, h.Hub, h.RoomService, "member_removed", change)
+
+	c.JSON(http.StatusOK, change)
+}
+
+// メンバーの役割を変更（admin / member）
+func (h *RoomHandler) ChangeMemberRole(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	targetID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	change, err := h.RoomService.ChangeRole(userID, roomID, uint(targetID), req.Role)
+	if err != nil {
+		respondRoomError(c, err, "failed to change role")
+		return
+	}
+	broadcastEvent(h.Hub, change.RoomID, "role_changed", change)
+
+	c.JSON(http.StatusOK, change)
+}
+
+// owner を譲る
+func (h *RoomHandler) TransferOwnership(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	var req struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	changes, err := h.RoomService.TransferOwnership(userID, roomID, req.UserID)
+	if err != nil {
+		respondRoomError(c, err, "failed to transfer ownership")
+		return
+	}
+	for _, change := range changes {
+		broadcastEvent(h.Hub, change.RoomID, "role_changed", change)
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// ピン留めしたメッセージ一覧
+func (h *RoomHandler) GetPinnedMessages(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+
+	pins, err := h.RoomService.GetPinnedMessages(userID, roomID)
+	if err != nil {
+		respondRoomError(c, err, "failed to get pinned messages")
+		return
+	}
+
+	c.JSON(http.StatusOK, pins)
+}
+
+// メッセージをピン留め
+func (h *RoomHandler) PinMessage(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	var req struct {
+		MessageID uint `json:"message_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.MessageID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	change, err := h.RoomService.PinMessage(userID, roomID, req.MessageID)
+	if err != nil {
+		respondRoomError(c, err, "failed to pin message")
+		return
+	}
+	if change != nil {
+		broadcastEvent(h.Hub, change.RoomID, "pin", change)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ピン留めを外す
+func (h *RoomHandler) UnpinMessage(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	change, err := h.RoomService.UnpinMessage(userID, roomID, uint(messageID))
+	if err != nil {
+		respondRoomError(c, err, "failed to unpin message")
+		return
+	}
+	if change != nil {
+		broadcastEvent(h.Hub, change.RoomID, "pin", change)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// 自分の通知設定
+func (h *RoomHandler) GetRoomSettings(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+
+	settings, err := h.RoomService.GetNotifySettings(userID, roomID.String())
+	if err != nil {
+		respondRoomError(c, err, "failed to get room settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// 通知設定を変更（all / mentions / muted、muted_until で期限付きミュート）
+func (h *RoomHandler) UpdateRoomSettings(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	roomID, err := uuid.Parse(c.Param("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	var req struct {
+		NotifyLevel string     `json:"notify_level"`
+		MutedUntil  *time.Time `json:"muted_until"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	settings, err := h.RoomService.UpdateNotifySettings(userID, roomID.String(), req.NotifyLevel, req.MutedUntil)
+	if err != nil {
+		respondRoomError(c, err, "failed to update room settings")
+		return
+	}
+	// 自分の他の端末のルーム一覧へ反映
+	notify.PublishToUser(h.RedisClient, userID, map[string]interface{}{
+		"type":         "room_settings",
+		"room_id":      settings.RoomID,
+		"notify_level": settings.NotifyLevel,
+		"muted_until":  settings.MutedUntil,
+	})
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// サービスのエラーをHTTPレスポンスに変換（想定外のエラーは fallback を返す）
+func respondRoomError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrNotGroupRoom), errors.Is(err, service.ErrInvalidMembers), errors.Is(err, service.ErrRemoveSelf), errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrInvalidNotifySettings):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMemberNotFound), errors.Is(err, service.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoomAccessDenied), errors.Is(err, service.ErrPermissionDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,18 +1,21 @@
 package handler
 
 import (
+	"chat-app/internal/presence"
 	"chat-app/internal/service"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 )
 
 type UserHandler struct {
 	UserService *service.UserService
+	RedisClient *redis.Client
 }
 
-func NewUserHandler(userService *service.UserService) *UserHandler {
-	return &UserHandler{UserService: userService}
+func NewUserHandler(userService *service.UserService, redisClient *redis.Client) *UserHandler {
+	return &UserHandler{UserService: userService, RedisClient: redisClient}
 }
 
 // ログイン中ユーザー以外のユーザー一覧を返す
@@ -35,6 +38,15 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 		return
 	}
 
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	attachPresence(h.RedisClient, ids, func(i int, p presence.Presence) {
+		users[i].Presence = p.Status
+		users[i].LastSeenAt = p.LastSeenAt
+	})
+
 	c.JSON(http.StatusOK, users)
 }
 
@@ -65,3 +77,47 @@ func (h *UserHandler) Me(c *gin.Context) {
 		"user_name": userName,
 	})
 }
+
+// ユーザー設定取得
+func (h *UserHandler) GetSettings(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	settings, err := h.UserService.GetSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ユーザー設定変更
+func (h *UserHandler) UpdateSettings(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	var req struct {
+		ReadReceiptsEnabled *bool `json:"read_receipts_enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ReadReceiptsEnabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	settings, err := h.UserService.UpdateReadReceipts(userID, *req.ReadReceiptsEnabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"chat-app/internal/eventlog"
+	"chat-app/internal/hub"
 	"chat-app/internal/model"
 	"chat-app/internal/notify"
 	"chat-app/internal/repository"
 	"chat-app/internal/service"
 	"chat-app/internal/util"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -26,22 +30,49 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-var roomClients = make(map[string]map[*websocket.Conn]string)
-var roomClientsMu sync.Mutex
+// 1接続ごとの状態
+type wsSession struct {
+	conn     *hub.Conn
+	userID   uint
+	userName string
+	roomID   uuid.UUID
+	protocol int  // 送信フレームの形式
+	muxed    bool // 多重化接続（/ws-mux）の1ルーム分。送信フレームに room を付ける
+
+	// 再接続時の再送（再送が終わるまでライブのイベントは pending に溜める）
+	eventMu   sync.Mutex
+	replaying bool
+	pending   []hub.Event
+	// 再送中に送ったイベントID（再送とライブで重なったイベントを1回だけ送る。再送が終われば nil）
+	// ライブの配信順はIDの順と一致しないことがあるので、IDの大小では判定しない
+	replayedIDs map[string]bool
+
+	typingAt time.Time // 最後に中継した「入力中」の時刻（未入力ならゼロ値。eventMu を取って読み書きする）
+}
+
+// v1 クライアントから送られる制御フレーム（JSON）
+// 各イベントのペイロードと同じフィールドをフラットに持つ
+type wsInbound struct {
+	Type string `json:"type"`
+}
 
 type WebSocketHandler struct {
 	MessageRepo     *repository.MessageRepository
+	MessageService  *service.MessageService
 	RoomService     *service.RoomService
 	NotifyWSHandler *NotifyWSHandler
 	RedisClient     *redis.Client
+	Hub             *hub.Hub
 }
 
-func NewWebSocketHandler(messageRepo *repository.MessageRepository, roomService *service.RoomService, notify *NotifyWSHandler, redisClient *redis.Client) *WebSocketHandler {
+func NewWebSocketHandler(messageRepo *repository.MessageRepository, messageService *service.MessageService, roomService *service.RoomService, notify *NotifyWSHandler, redisClient *redis.Client, roomHub *hub.Hub) *WebSocketHandler {
 	return &WebSocketHandler{
 		MessageRepo:     messageRepo,
+		MessageService:  messageService,
 		RoomService:     roomService,
 		NotifyWSHandler: notify,
 		RedisClient:     redisClient,
+		Hub:             roomHub,
 	}
 }
 
@@ -75,79 +106,521 @@ func (h *WebSocketHandler) Handle(c *gin.Context) {
 		return
 	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	// 再接続時は最後に受け取ったイベントID以降を再送
+	since := c.Query("since")
+	if since != "" && eventlog.Validate(since) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+		return
+	}
+
+	protocol, err := negotiateProtocol(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": errCodeUnsupportedVersion, "supported": []int{protocolV1, protocolV2}})
+		return
+	}
+
+	// サブプロトコルで要求された場合は同じ名前を返す
+	var respHeader http.Header
+	if requestsSubprotocolV2(c.Request) {
+		respHeader = http.Header{"Sec-WebSocket-Protocol": {subprotocolV2}}
+	}
+
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, respHeader)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upgrade to websocket"})
 		return
 	}
 
-	roomClientsMu.Lock()
-	if roomClients[roomIDStr] == nil {
-		roomClients[roomIDStr] = make(map[*websocket.Conn]string)
+	session := &wsSession{
+		conn:     hub.NewConn(ws, "room"),
+		userID:   userID,
+		userName: userName,
+		roomID:   roomID,
+		protocol: protocol,
+
+		replaying: since != "",
+	}
+
+	// v2 は接続直後に確定したバージョンを通知
+	if protocol >= protocolV2 {
+		session.reply("hello", "", map[string]interface{}{
+			"protocol": protocol,
+			"room_id":  roomID,
+			"user_id":  userID,
+		})
 	}
-	roomClients[roomIDStr][conn] = userName
-	roomClientsMu.Unlock()
 
-	defer func() {
-		roomClientsMu.Lock()
-		delete(roomClients[roomIDStr], conn)
-		if len(roomClients[roomIDStr]) == 0 {
-			delete(roomClients, roomIDStr)
+	// 取りこぼしを防ぐため、購読を始めてから再送する
+	h.Hub.Join(roomIDStr, userID, session)
+	if since != "" {
+		h.replay(session, since)
+	}
+
+	// 接続中はオンライン（切断で解除）
+	go trackPresence(h.RedisClient, h.RoomService, userID, session.conn.Done())
+	activity := activityTracker{at: time.Now()}
+
+	session.conn.Run(func(msgBytes []byte) {
+		activity.touch(h.RedisClient, h.RoomService, userID)
+		if protocol >= protocolV2 {
+			h.handleEnvelope(session, msgBytes)
+		} else {
+			h.handleLegacy(session, msgBytes)
 		}
-		roomClientsMu.Unlock()
-		conn.Close()
-	}()
+	})
 
-	for {
-		_, msgBytes, err := conn.ReadMessage()
-		if err != nil {
-			break
+	h.Hub.Leave(roomIDStr, session)
+	// 入力中のまま切断したら入力終了を通知
+	h.stopTyping(session)
+}
+
+// v2: エンベロープを処理し、ack / error を返す
+func (h *WebSocketHandler) handleEnvelope(s *wsSession, data []byte) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Type == "" {
+		s.replyError("", badRequest("invalid envelope"))
+		return
+	}
+	if env.V != 0 && env.V != s.protocol {
+		s.replyError(env.ID, &wsError{Code: errCodeUnsupportedVersion, Message: "protocol version mismatch"})
+		return
+	}
+
+	h.handleRoomFrame(s, &env)
+}
+
+// ルーム宛てのフレームを処理して ack / error を返す
+func (h *WebSocketHandler) handleRoomFrame(s *wsSession, env *envelope) {
+	result, err := h.dispatch(s, env.Type, env.Payload)
+	if err != nil {
+		s.replyError(env.ID, err)
+		return
+	}
+	// id のないフレームは投げっぱなし（typing など）
+	if env.ID != "" {
+		s.reply("ack", env.ID, result)
+	}
+}
+
+// v1 の制御フレームの type（これ以外は JSON でも本文として保存する）
+var legacyControlTypes = map[string]bool{
+	"send":   true,
+	"edit":   true,
+	"delete": true,
+	"typing": true,
+	"read":   true,
+}
+
+// v1 のフレームが制御フレームなら、その type を返す
+// 旧クライアントは本文をそのまま送るため、JSON を貼り付けたメッセージも本文として扱う
+func legacyControlType(data []byte) (string, bool) {
+	var in wsInbound
+	if json.Unmarshal(data, &in) != nil || !legacyControlTypes[in.Type] {
+		return "", false
+	}
+	return in.Type, true
+}
+
+// v1: 制御フレームか、メッセージ本文のテキスト
+// 失敗はログのみ（client_id 付きの send にだけ ack を返す）
+func (h *WebSocketHandler) handleLegacy(s *wsSession, data []byte) {
+	eventType, ok := legacyControlType(data)
+	if !ok {
+		if _, err := h.send(s, sendPayload{Content: string(data)}); err != nil {
+			fmt.Println("WebSocketイベント処理失敗:", err)
 		}
+		return
+	}
+
+	result, err := h.dispatch(s, eventType, data)
+	if err != nil {
+		fmt.Println("WebSocketイベント処理失敗:", err)
+		return
+	}
+	if ack, ok := result.(*sendAck); ok && ack.ClientID != nil {
+		s.reply("ack", "", ack)
+	}
+}
 
-		msg := &model.Message{
-			RoomID:   roomID,
-			SenderID: userID,
-			Sender:   userName,
-			Content:  string(msgBytes),
+// イベントを処理し、ack に載せる結果を返す
+func (h *WebSocketHandler) dispatch(s *wsSession, eventType string, raw json.RawMessage) (interface{}, error) {
+	switch eventType {
+	case "send":
+		var p sendPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return nil, err
+		}
+		return h.send(s, p)
+	case "edit":
+		var p editPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return nil, err
+		}
+		if p.MessageID == 0 {
+			return nil, badRequest("message_id is required")
+		}
+		msg, err := h.MessageService.EditMessage(s.userID, p.MessageID, p.Content)
+		if err != nil {
+			return nil, err
+		}
+		broadcastEvent(h.Hub, msg.RoomID.String(), "edit", msg)
+		return msg, nil
+	case "delete":
+		var p deletePayload
+		if err := decodePayload(raw, &p); err != nil {
+			return nil, err
+		}
+		if p.MessageID == 0 {
+			return nil, badRequest("message_id is required")
+		}
+		if p.Scope == "me" {
+			msg, err := h.MessageService.HideForUser(s.userID, p.MessageID)
+			if err != nil {
+				return nil, err
+			}
+			publishMessageHidden(h.RedisClient, s.userID, msg)
+			return gin.H{"message_id": msg.ID, "scope": "me"}, nil
+		}
+		msg, lastMessage, err := h.MessageService.DeleteForEveryone(s.userID, p.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		publishMessageDeleted(h.RedisClient, h.Hub, h.RoomService, msg, lastMessage)
+		return gin.H{"message_id": msg.ID, "scope": "everyone"}, nil
+	case "typing":
+		var p typingPayload
+		if err := decodePayload(raw, &p); err != nil {
+			return nil, err
+		}
+		if p.Typing != nil && !*p.Typing {
+			h.stopTyping(s)
+		} else {
+			h.startTyping(s)
+		}
+		return nil, nil
+	case "read":
+		var p readPayload
+		if len(raw) > 0 {
+			if err := decodePayload(raw, &p); err != nil {
+				return nil, err
+			}
 		}
+		receipt, err := h.RoomService.MarkAsRead(s.userID, s.roomID.String(), p.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		publishReadReceipt(h.RedisClient, h.Hub, receipt)
+		return receipt, nil
+	default:
+		return nil, &wsError{Code: errCodeUnsupportedType, Message: "unsupported event type: " + eventType}
+	}
+}
 
-		loc, _ := time.LoadLocation("Asia/Tokyo")
-		msg.CreatedAt = time.Now().In(loc)
+// 既読位置が進んだことを他のメンバーに知らせる（既読を知らせない設定なら送らない）
+// 1対1ルームで配信状況が変わっていれば送信者にも通知する
+func publishReadReceipt(rdb *redis.Client, roomHub *hub.Hub, receipt *service.ReadReceipt) {
+	publishMessageStatus(rdb, receipt.Status)
+	if !receipt.Broadcast {
+		return
+	}
+	broadcastEventExcept(roomHub, receipt.RoomID, "read", receipt, receipt.UserID)
+}
+
+// メッセージを保存して配信（再送で保存済みなら配信せず ack だけ返す）
+func (h *WebSocketHandler) send(s *wsSession, p sendPayload) (*sendAck, error) {
+	msg, duplicate, err := h.MessageService.SendMessage(s.userID, s.userName, s.roomID, service.SendParams{
+		Content:       p.Content,
+		ParentID:      p.ParentID,
+		AttachmentIDs: p.AttachmentIDs,
+		ClientID:      p.ClientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !duplicate {
+		h.stopTyping(s)
+		publishNewMessage(h.RedisClient, h.Hub, h.RoomService, h.MessageRepo, msg)
+	}
+	return &sendAck{
+		ID:        msg.ID,
+		ClientID:  msg.ClientID,
+		CreatedAt: msg.CreatedAt,
+		Duplicate: duplicate,
+		Message:   msg,
+	}, nil
+}
+
+// ペイロードを読み込む（空なら各フィールドはゼロ値のまま）
+func decodePayload(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return badRequest("invalid payload")
+	}
+	return nil
+}
 
-		if err := h.MessageRepo.SaveMessage(msg); err != nil {
-			fmt.Println("DB保存失敗:", err)
+// この接続へ ack / error などを送信
+func (s *wsSession) reply(eventType string, id string, payload interface{}) {
+	var raw json.RawMessage
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			fmt.Println("イベントのJSON変換に失敗:", err)
+			return
 		}
+		raw = b
+	}
+
+	var data []byte
+	var err error
+	if s.protocol >= protocolV2 {
+		data, err = json.Marshal(envelope{V: s.protocol, Type: eventType, ID: id, Room: s.room(), Payload: raw})
+	} else {
+		data, err = roomEvent{Type: eventType, Payload: raw}.render(s.protocol)
+	}
+	if err != nil {
+		return
+	}
+	s.conn.Enqueue(data)
+}
 
-		// 🔔 通知送信（送信者も含めて全員）
-		members, err := h.RoomService.GetMembersByRoomID(roomID.String())
-		if err == nil {
-			for _, m := range members {
-				notifyMsg := map[string]interface{}{
-					"room_id":    msg.RoomID,
-					"sender_id":  msg.SenderID,
-					"sender":     msg.Sender,
-					"content":    msg.Content,
-					"last_message": msg.Content,
-					"created_at": msg.CreatedAt.Format(time.RFC3339),
-					"from_self":  m.ID == msg.SenderID,
-				}
-				notify.PublishToUser(h.RedisClient, m.ID, notifyMsg)
+func (s *wsSession) replyError(id string, err error) {
+	payload := toErrorPayload(err)
+	if payload.Code == errCodeInternal {
+		fmt.Println("WebSocketイベント処理失敗:", err)
+	}
+	s.reply("error", id, payload)
+}
+
+// 切断中のイベントを再送し、その間に届いたライブのイベントを続けて送る
+func (h *WebSocketHandler) replay(s *wsSession, since string) {
+	events, err := h.Hub.Replay(context.Background(), s.roomID.String(), since)
+
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+
+	s.replayedIDs = make(map[string]bool)
+	switch {
+	case errors.Is(err, eventlog.ErrTooFarBehind):
+		// 再送できないので、クライアントに履歴の再取得を求める
+		s.reply("resync_required", "", gin.H{"since": since})
+	case err != nil:
+		fmt.Println("イベント再送失敗:", err)
+		s.reply("resync_required", "", gin.H{"since": since})
+	default:
+		for _, ev := range events {
+			if ev.ExcludeUserID != 0 && ev.ExcludeUserID == s.userID {
+				continue
 			}
+			s.deliver(ev)
 		}
+	}
 
-		jsonMsg, err := json.Marshal(msg)
-		if err != nil {
-			fmt.Println("メッセージのJSON変換に失敗:", err)
-			continue
+	for _, ev := range s.pending {
+		s.deliver(ev)
+	}
+	s.pending = nil
+	s.replaying = false
+	s.replayedIDs = nil
+}
+
+// 多重化接続ならフレームに付けるルームID
+func (s *wsSession) room() string {
+	if !s.muxed {
+		return ""
+	}
+	return s.roomID.String()
+}
+
+// ハブから届いたルームイベント
+func (s *wsSession) Send(ev hub.Event) {
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+
+	if s.replaying {
+		s.pending = append(s.pending, ev)
+		return
+	}
+	s.deliver(ev)
+}
+
+// この接続のプロトコルで送信（再送と重なったイベントは飛ばす。eventMu を取って呼ぶ）
+func (s *wsSession) deliver(ev hub.Event) {
+	if ev.ID != "" && s.replayedIDs != nil {
+		if s.replayedIDs[ev.ID] {
+			return
 		}
+		s.replayedIDs[ev.ID] = true
+	}
 
-		roomClientsMu.Lock()
-		for c := range roomClients[roomIDStr] {
-			if err := c.WriteMessage(websocket.TextMessage, jsonMsg); err != nil {
-				c.Close()
-				delete(roomClients[roomIDStr], c)
+	data, err := roomEvent{EventID: ev.ID, RoomID: s.room(), Type: ev.Type, Payload: ev.Payload}.render(s.protocol)
+	if err != nil {
+		fmt.Println("イベントのJSON変換に失敗:", err)
+		return
+	}
+	// キューが溢れた遅い接続は切断される
+	s.conn.Enqueue(data)
+
+	// メンバーから外されたらルーム接続を閉じる（多重化接続は通知の room_removed で購読を取り消す）
+	if ev.Type == "member_removed" && !s.muxed && removedFrom(ev.Payload, s.userID) {
+		s.conn.Close()
+	}
+}
+
+// member_removed のイベントに userID が含まれるか
+func removedFrom(payload json.RawMessage, userID uint) bool {
+	var change service.MembershipChange
+	if err := json.Unmarshal(payload, &change); err != nil {
+		return false
+	}
+	for _, u := range change.Users {
+		if u.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// イベントを全インスタンスのルーム接続へ送信
+func broadcastEvent(roomHub *hub.Hub, roomID string, eventType string, payload interface{}) {
+	broadcastEventExcept(roomHub, roomID, eventType, payload, 0)
+}
+
+// イベントを全インスタンスのルーム接続へ送信（excludeUserID の接続は除く）
+func broadcastEventExcept(roomHub *hub.Hub, roomID string, eventType string, payload interface{}, excludeUserID uint) {
+	if err := roomHub.Publish(context.Background(), roomID, eventType, payload, excludeUserID); err != nil {
+		fmt.Println("ルームイベント送信失敗:", err)
+	}
+}
+
+// 新着メッセージをルームの接続と各メンバーの通知へ送信
+func publishNewMessage(rdb *redis.Client, roomHub *hub.Hub, roomService *service.RoomService, messageRepo *repository.MessageRepository, msg *model.Message) {
+	notifyNewMessage(rdb, roomService, msg)
+
+	// スレッド返信は親の返信数とあわせて専用イベントで送信
+	if msg.ParentID != nil {
+		parent, err := messageRepo.FindMessageByID(*msg.ParentID)
+		if err != nil || parent == nil {
+			fmt.Println("親メッセージ取得失敗:", err)
+			return
+		}
+		broadcastEvent(roomHub, msg.RoomID.String(), "thread_reply", map[string]interface{}{
+			"message":       msg,
+			"parent_id":     parent.ID,
+			"reply_count":   parent.ReplyCount,
+			"last_reply_at": parent.LastReplyAt,
+		})
+		return
+	}
+
+	broadcastEvent(roomHub, msg.RoomID.String(), "message", msg)
+}
+
+// 新着メッセージを各メンバーの通知へ送信
+func notifyNewMessage(rdb *redis.Client, roomService *service.RoomService, msg *model.Message) {
+	mentioned := make(map[uint]bool)
+	for _, uid := range msg.Mentions {
+		mentioned[uid] = true
+	}
+
+	// ミュート・メンションのみのメンバー（取得できなければ全員に通知）
+	levels, _ := roomService.NotifyLevels(msg.RoomID.String())
+
+	// 🔔 通知送信（送信者も含めて全員）
+	// ルーム一覧の更新や配信済みの確認にも使うので、通知設定で知らせないメンバーにも silent を付けて送る
+	members, err := roomService.GetMembersByRoomID(msg.RoomID.String())
+	if err == nil {
+		for _, m := range members {
+			silent := m.ID != msg.SenderID && !service.ShouldNotify(levels[m.ID], mentioned[m.ID] || msg.MentionAll)
+			notifyMsg := map[string]interface{}{
+				"type":         "message",
+				"room_id":      msg.RoomID,
+				"message_id":   msg.ID,
+				"parent_id":    msg.ParentID,
+				"sender_id":    msg.SenderID,
+				"sender":       msg.Sender,
+				"content":      msg.Content,
+				"kind":         msg.Kind,
+				"last_message": msg.Content,
+				"created_at":   msg.CreatedAt.Format(time.RFC3339),
+				"from_self":    m.ID == msg.SenderID,
+				"mentioned":    mentioned[m.ID],
+				"silent":       silent, // true ならクライアントは音やバナーを出さない
+			}
+			notify.PublishToUser(rdb, m.ID, notifyMsg)
+		}
+	}
+}
+
+// メンバーの追加・削除をルームの接続と各ユーザーの通知へ送信
+// eventType は "member_added" か "member_removed"
+func publishMembershipChange(rdb *redis.Client, roomHub *hub.Hub, roomService *service.RoomService, eventType string, change *service.MembershipChange) {
+	if change.Message == nil {
+		return
+	}
+	// 削除されたユーザーのルーム接続はこのイベントで切断される
+	broadcastEvent(roomHub, change.RoomID, eventType, change)
+	broadcastEvent(roomHub, change.RoomID, "message", change.Message)
+	notifyNewMessage(rdb, roomService, change.Message)
+
+	// 追加・削除されたユーザー本人へ（ルーム一覧の更新、多重化接続の購読の取り消し）
+	for _, u := range change.Users {
+		notifyType := "room_added"
+		if eventType == "member_removed" {
+			notifyType = "room_removed"
+			// 自分で抜けた場合は退会と同じ
+			if u.ID == change.ActorID {
+				notifyType = "room_left"
 			}
 		}
-		roomClientsMu.Unlock()
+		notify.PublishToUser(rdb, u.ID, map[string]interface{}{
+			"type":     notifyType,
+			"room_id":  change.RoomID,
+			"actor_id": change.ActorID,
+		})
 	}
 }
+
+// 全員から削除されたことをルームの接続と各メンバーの通知へ送信
+func publishMessageDeleted(rdb *redis.Client, roomHub *hub.Hub, roomService *service.RoomService, msg *model.Message, lastMessage string) {
+	broadcastEvent(roomHub, msg.RoomID.String(), "delete", msg)
+
+	members, err := roomService.GetMembersByRoomID(msg.RoomID.String())
+	if err != nil {
+		fmt.Println("メンバー取得失敗:", err)
+		return
+	}
+	for _, m := range members {
+		notify.PublishToUser(rdb, m.ID, map[string]interface{}{
+			"type":         "message_deleted",
+			"room_id":      msg.RoomID,
+			"message_id":   msg.ID,
+			"last_message": lastMessage,
+		})
+	}
+}
+
+// 1対1ルームの配信状況の変化を送信者へ通知（update が nil なら何もしない）
+func publishMessageStatus(rdb *redis.Client, update *service.MessageStatusUpdate) {
+	if update == nil {
+		return
+	}
+	notify.PublishToUser(rdb, update.SenderID, map[string]interface{}{
+		"type":       "message_status",
+		"room_id":    update.RoomID,
+		"message_id": update.MessageID,
+		"status":     update.Status,
+		"at":         update.At.Format(time.RFC3339),
+	})
+}
+
+// 自分だけ削除したことを本人の他の端末へ通知
+func publishMessageHidden(rdb *redis.Client, userID uint, msg *model.Message) {
+	notify.PublishToUser(rdb, userID, map[string]interface{}{
+		"type":       "message_hidden",
+		"room_id":    msg.RoomID,
+		"message_id": msg.ID,
+	})
+}
@@ -0,0 +1,30 @@
+package handler
+
+import "testing"
+
+// v1 では既知の type の JSON だけを制御フレームとし、それ以外は本文として扱う
+func TestLegacyControlType(t *testing.T) {
+	tests := []struct {
+		frame    string
+		wantType string
+		wantOK   bool
+	}{
+		{`{"type":"send","content":"hi"}`, "send", true},
+		{`{"type":"typing"}`, "typing", true},
+		{`{"type":"read","message_id":1}`, "read", true},
+		// 本文として保存するもの
+		{`こんにちは`, "", false},
+		{`{"type":"order","item":"coffee"}`, "", false},
+		{`{"type":""}`, "", false},
+		{`{"name":"x"}`, "", false},
+		{`{"type":1}`, "", false},
+		{`["send"]`, "", false},
+		{`{"type":"Send"}`, "", false},
+	}
+	for _, tt := range tests {
+		gotType, gotOK := legacyControlType([]byte(tt.frame))
+		if gotType != tt.wantType || gotOK != tt.wantOK {
+			t.Errorf("legacyControlType(%s) = %q, %v; want %q, %v", tt.frame, gotType, gotOK, tt.wantType, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"chat-app/internal/eventlog"
+	"chat-app/internal/hub"
+	"chat-app/internal/util"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 通知のうち、受け取ったらそのルームの購読を取り消すもの
+var revokingNotifications = map[string]bool{
+	"room_left":    true, // 自分が退会した
+	"room_removed": true, // メンバーから外された
+	"room_deleted": true, // ルームが削除された
+}
+
+// 多重化接続（/ws-mux）
+// 1本の接続で複数ルームを購読し、ユーザー宛ての通知もあわせて受け取る（プロトコルは v2 のみ）
+//
+//	subscribe   {room_id, since?} ルームを購読（毎回 AuthorizeUser で確認）
+//	unsubscribe {room_id}         購読をやめる
+//	send / edit / delete / typing / read はエンベロープの room で対象ルームを指定する
+//	notify_ack  {event_id}        通知の受信確認（/ws-notify の ack と同じ）
+//	通知は type: "notify"、payload に /ws-notify と同じ内容を入れて送る
+type muxConn struct {
+	conn     *hub.Conn
+	userID   uint
+	userName string
+
+	mu    sync.Mutex
+	rooms map[uuid.UUID]*wsSession
+}
+
+type subscribePayload struct {
+	RoomID uuid.UUID `json:"room_id"`
+	Since  string    `json:"since"` // このルームで最後に受け取った event_id
+}
+
+type notifyAckPayload struct {
+	EventID string `json:"event_id"`
+}
+
+func (h *WebSocketHandler) HandleMux(c *gin.Context) {
+	tokenStr := c.Query("token")
+	if tokenStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		return
+	}
+
+	userID, userName, err := util.ValidateJWTAndExtract(tokenStr)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	// 通知の再送（/ws-notify の ?since= と同じ）
+	since := c.Query("since")
+	if since != "" && eventlog.Validate(since) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+		return
+	}
+
+	var respHeader http.Header
+	if requestsSubprotocolV2(c.Request) {
+		respHeader = http.Header{"Sec-WebSocket-Protocol": {subprotocolV2}}
+	}
+
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, respHeader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upgrade to websocket"})
+		return
+	}
+
+	m := &muxConn{
+		conn:     hub.NewConn(ws, "mux"),
+		userID:   userID,
+		userName: userName,
+		rooms:    make(map[uuid.UUID]*wsSession),
+	}
+
+	m.reply("hello", "", "", map[string]interface{}{
+		"protocol": protocolV2,
+		"user_id":  userID,
+	})
+
+	go h.forwardNotifications(m, since)
+	go trackPresence(h.RedisClient, h.RoomService, userID, m.conn.Done())
+	activity := activityTracker{at: time.Now()}
+
+	m.conn.Run(func(data []byte) {
+		activity.touch(h.RedisClient, h.RoomService, userID)
+		h.handleMuxFrame(m, data)
+	})
+
+	m.mu.Lock()
+	for roomID := range m.rooms {
+		h.unsubscribeLocked(m, roomID)
+	}
+	m.mu.Unlock()
+}
+
+func (h *WebSocketHandler) handleMuxFrame(m *muxConn, data []byte) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Type == "" {
+		m.replyError("", "", badRequest("invalid envelope"))
+		return
+	}
+	if env.V != 0 && env.V != protocolV2 {
+		m.replyError(env.ID, env.Room, &wsError{Code: errCodeUnsupportedVersion, Message: "protocol version mismatch"})
+		return
+	}
+
+	switch env.Type {
+	case "subscribe":
+		var p subscribePayload
+		if err := decodePayload(env.Payload, &p); err != nil {
+			m.replyError(env.ID, "", err)
+			return
+		}
+		if err := h.subscribeRoom(m, p); err != nil {
+			m.replyError(env.ID, p.RoomID.String(), err)
+			return
+		}
+		m.reply("ack", env.ID, p.RoomID.String(), gin.H{"room_id": p.RoomID})
+	case "notify_ack":
+		var p notifyAckPayload
+		if err := decodePayload(env.Payload, &p); err != nil {
+			m.replyError(env.ID, "", err)
+			return
+		}
+		if eventlog.Validate(p.EventID) != nil {
+			m.replyError(env.ID, "", badRequest("invalid event_id"))
+			return
+		}
+		if err := h.NotifyWSHandler.acknowledge(m.userID, p.EventID); err != nil {
+			m.replyError(env.ID, "", err)
+			return
+		}
+		m.reply("ack", env.ID, "", gin.H{"event_id": p.EventID})
+	case "unsubscribe":
+		var p subscribePayload
+		if err := decodePayload(env.Payload, &p); err != nil {
+			m.replyError(env.ID, "", err)
+			return
+		}
+		m.mu.Lock()
+		h.unsubscribeLocked(m, p.RoomID)
+		m.mu.Unlock()
+		m.reply("ack", env.ID, p.RoomID.String(), gin.H{"room_id": p.RoomID})
+	default:
+		roomID, err := uuid.Parse(env.Room)
+		if err != nil {
+			m.replyError(env.ID, env.Room, badRequest("room is required"))
+			return
+		}
+		m.mu.Lock()
+		s := m.rooms[roomID]
+		m.mu.Unlock()
+		if s == nil {
+			m.replyError(env.ID, env.Room, &wsError{Code: errCodeForbidden, Message: "not subscribed to room"})
+			return
+		}
+		h.handleRoomFrame(s, &env)
+	}
+}
+
+// ルームを購読（メンバーでなければ拒否）
+func (h *WebSocketHandler) subscribeRoom(m *muxConn, p subscribePayload) error {
+	if p.RoomID == uuid.Nil {
+		return badRequest("room_id is required")
+	}
+	if p.Since != "" && eventlog.Validate(p.Since) != nil {
+		return badRequest("invalid since")
+	}
+	if err := h.RoomService.AuthorizeUser(m.userID, p.RoomID); err != nil {
+		return &wsError{Code: errCodeForbidden, Message: "unauthorized"}
+	}
+
+	m.mu.Lock()
+	if _, ok := m.rooms[p.RoomID]; ok {
+		m.mu.Unlock()
+		return nil
+	}
+	s := &wsSession{
+		conn:     m.conn,
+		userID:   m.userID,
+		userName: m.userName,
+		roomID:   p.RoomID,
+		protocol: protocolV2,
+		muxed:    true,
+
+		replaying: p.Since != "",
+	}
+	m.rooms[p.RoomID] = s
+	h.Hub.Join(p.RoomID.String(), m.userID, s)
+	m.mu.Unlock()
+
+	if p.Since != "" {
+		h.replay(s, p.Since)
+	}
+	return nil
+}
+
+// 購読をやめる（m.mu を取って呼ぶ）
+func (h *WebSocketHandler) unsubscribeLocked(m *muxConn, roomID uuid.UUID) {
+	s := m.rooms[roomID]
+	if s == nil {
+		return
+	}
+	delete(m.rooms, roomID)
+	h.Hub.Leave(roomID.String(), s)
+	h.stopTyping(s)
+}
+
+// ユーザー宛ての通知を転送し、退会・削除の通知でルームの購読を取り消す
+func (h *WebSocketHandler) forwardNotifications(m *muxConn, since string) {
+	streamNotifications(h.RedisClient, m.userID, since, m.conn.Done(), nil, func(payload string) bool {
+		var n struct {
+			Type    string `json:"type"`
+			RoomID  string `json:"room_id"`
+			EventID string `json:"event_id"`
+		}
+		json.Unmarshal([]byte(payload), &n)
+
+		if revokingNotifications[n.Type] {
+			if roomID, err := uuid.Parse(n.RoomID); err == nil {
+				m.mu.Lock()
+				_, subscribed := m.rooms[roomID]
+				h.unsubscribeLocked(m, roomID)
+				m.mu.Unlock()
+				if subscribed {
+					m.reply("unsubscribed", "", n.RoomID, gin.H{"room_id": roomID, "reason": n.Type})
+				}
+			}
+		}
+
+		data, err := json.Marshal(envelope{V: protocolV2, Type: "notify", EventID: n.EventID, Payload: json.RawMessage(payload)})
+		if err != nil {
+			return true
+		}
+		return m.conn.Enqueue(data)
+	})
+	m.conn.Close()
+}
+
+func (m *muxConn) reply(eventType string, id string, room string, payload interface{}) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Println("イベントのJSON変換に失敗:", err)
+		return
+	}
+	data, err := json.Marshal(envelope{V: protocolV2, Type: eventType, ID: id, Room: room, Payload: raw})
+	if err != nil {
+		return
+	}
+	m.conn.Enqueue(data)
+}
+
+func (m *muxConn) replyError(id string, room string, err error) {
+	payload := toErrorPayload(err)
+	if payload.Code == errCodeInternal {
+		fmt.Println("WebSocketイベント処理失敗:", err)
+	}
+	m.reply("error", id, room, payload)
+}
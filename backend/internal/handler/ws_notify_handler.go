@@ -1,27 +1,40 @@
 package handler
 
 import (
+	"chat-app/internal/eventlog"
+	"chat-app/internal/hub"
+	"chat-app/internal/notify"
+	"chat-app/internal/service"
 	"chat-app/internal/util"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
 )
 
+// 1ユーザーが複数端末で接続できるよう、接続ごとに管理する
 type NotifyWSHandler struct {
-	UserClients map[uint]*websocket.Conn
+	UserClients map[uint]map[*hub.Conn]string // ユーザーID → 接続 → セッションID
 	RedisClient *redis.Client
+	RoomService *service.RoomService
+
+	mu sync.Mutex // UserClients の保護
 }
 
-func NewNotifyWSHandler(redisClient *redis.Client) *NotifyWSHandler {
+func NewNotifyWSHandler(redisClient *redis.Client, roomService *service.RoomService) *NotifyWSHandler {
 	return &NotifyWSHandler{
-		UserClients: make(map[uint]*websocket.Conn),
+		UserClients: make(map[uint]map[*hub.Conn]string),
 		RedisClient: redisClient,
+		RoomService: roomService,
 	}
 }
 
@@ -42,44 +55,201 @@ func (h *NotifyWSHandler) Handle(c *gin.Context) {
 		return
 	}
 
-	conn, err := upgrade.Upgrade(c.Writer, c.Request, nil)
+	// 再接続時は最後に受け取った event_id 以降を再送
+	since := c.Query("since")
+	if since != "" && eventlog.Validate(since) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+		return
+	}
+
+	ws, err := upgrade.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
 	}
+	conn := hub.NewConn(ws, "notify")
 
-	h.UserClients[userID] = conn
-	go h.subscribe(userID, conn)
+	now := time.Now()
+	session := notify.Session{
+		ID:          uuid.New().String(),
+		UserAgent:   c.Request.UserAgent(),
+		IP:          c.ClientIP(),
+		ConnectedAt: now,
+		LastSeenAt:  now,
+	}
+	if err := notify.SaveSession(h.RedisClient, userID, session); err != nil {
+		log.Println("セッション登録失敗:", err)
+	}
 
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			delete(h.UserClients, userID)
-			conn.Close()
-			break
+	h.mu.Lock()
+	if h.UserClients[userID] == nil {
+		h.UserClients[userID] = make(map[*hub.Conn]string)
+	}
+	h.UserClients[userID][conn] = session.ID
+	h.mu.Unlock()
+	go h.subscribe(userID, conn, session, since)
+	// 接続中はオンライン（切断で解除）
+	go trackPresence(h.RedisClient, h.RoomService, userID, conn.Done())
+
+	// 受信するのは通知の受信確認だけ（{"type":"ack","event_id":"..."}）
+	conn.Run(func(data []byte) {
+		var frame struct {
+			Type    string `json:"type"`
+			EventID string `json:"event_id"`
+		}
+		if err := json.Unmarshal(data, &frame); err != nil || frame.Type != "ack" || eventlog.Validate(frame.EventID) != nil {
+			return
 		}
+		if err := h.acknowledge(userID, frame.EventID); err != nil {
+			log.Println("通知の受信確認に失敗:", err)
+		}
+	})
+
+	h.mu.Lock()
+	delete(h.UserClients[userID], conn)
+	if len(h.UserClients[userID]) == 0 {
+		delete(h.UserClients, userID)
+	}
+	h.mu.Unlock()
+
+	if err := notify.RemoveSession(h.RedisClient, userID, session.ID); err != nil {
+		log.Println("セッション削除失敗:", err)
+	}
+}
+
+// 通知の受信確認（新着メッセージの通知なら、1対1ルームのメッセージを配信済みにして送信者へ知らせる）
+// 内容は本人宛ての通知ログから取り出すので、クライアントが送るのは event_id だけ
+func (h *NotifyWSHandler) acknowledge(userID uint, eventID string) error {
+	payload, err := notify.Lookup(h.RedisClient, userID, eventID)
+	if err != nil || payload == "" {
+		return err
+	}
+
+	var n struct {
+		Type      string `json:"type"`
+		RoomID    string `json:"room_id"`
+		MessageID uint   `json:"message_id"`
+		FromSelf  bool   `json:"from_self"`
+	}
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		return err
+	}
+	if n.Type != "message" || n.FromSelf {
+		return nil
+	}
+
+	update, err := h.RoomService.MarkDelivered(userID, n.RoomID, n.MessageID)
+	if err != nil {
+		return err
 	}
+	publishMessageStatus(h.RedisClient, update)
+	return nil
 }
 
-func (h *NotifyWSHandler) subscribe(userID uint, conn *websocket.Conn) {
+// 接続ごとに購読し、切断されるまで通知を送信キューへ流す（切断時に購読も閉じる）
+func (h *NotifyWSHandler) subscribe(userID uint, conn *hub.Conn, session notify.Session, since string) {
+	heartbeat := func() {
+		session.LastSeenAt = time.Now()
+		if err := notify.SaveSession(h.RedisClient, userID, session); err != nil {
+			log.Println("セッション更新失敗:", err)
+		}
+	}
+
+	streamNotifications(h.RedisClient, userID, since, conn.Done(), heartbeat, func(payload string) bool {
+		if !conn.Enqueue([]byte(payload)) {
+			log.Println("通知送信失敗: 接続が閉じられました")
+			return false
+		}
+		return true
+	})
+	// 購読が終わったら（Redis の障害など）切断して再接続してもらう
+	conn.Close()
+}
+
+// ユーザーの通知を購読し、since 以降の再送分に続けてライブの通知を fn に渡す
+// done が閉じるか fn が false を返すまで続け、終了時に購読を閉じる
+// heartbeat は notify.SessionHeartbeat ごとに呼ぶ（nil 可）
+func streamNotifications(rdb *redis.Client, userID uint, since string, done <-chan struct{}, heartbeat func(), fn func(payload string) bool) {
 	channel := fmt.Sprintf("user:%d", userID)
-	pubsub := h.RedisClient.Subscribe(context.Background(), channel)
+	pubsub := rdb.Subscribe(context.Background(), channel)
+	defer pubsub.Close()
+
+	// 購読が確立してから再送する（再送中に届いた通知はチャンネルに溜まる）
+	// 再送した通知はライブでも届くことがあるので、IDを覚えておいて1回だけ送る
+	// （ライブの配信順はIDの順と一致しないことがあるので、IDの大小では判定しない）
+	var replayed map[string]bool
+	if since != "" {
+		if _, err := pubsub.Receive(context.Background()); err != nil {
+			log.Println("通知の購読失敗:", err)
+			return
+		}
+		payloads, err := notify.Replay(rdb, userID, since)
+		if err != nil {
+			if !errors.Is(err, eventlog.ErrTooFarBehind) {
+				log.Println("通知の再送失敗:", err)
+			}
+			// 再送できないので、クライアントにルーム一覧などの再取得を求める
+			data, _ := json.Marshal(gin.H{"type": "resync_required", "since": since})
+			if !fn(string(data)) {
+				return
+			}
+		}
+		replayed = make(map[string]bool, len(payloads))
+		for _, p := range payloads {
+			if !fn(p) {
+				return
+			}
+			replayed[notify.EventID(p)] = true
+		}
+	}
 	ch := pubsub.Channel()
 
-	for msg := range ch {
-		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
-			log.Println("通知送信失敗:", err)
-			conn.Close()
-			break
+	var tick <-chan time.Time
+	if heartbeat != nil {
+		ticker := time.NewTicker(notify.SessionHeartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			// 再送済みの通知は飛ばす
+			if id := notify.EventID(msg.Payload); id != "" && replayed[id] {
+				delete(replayed, id)
+				continue
+			}
+			if !fn(msg.Payload) {
+				return
+			}
+		case <-tick:
+			heartbeat()
+		case <-done:
+			return
 		}
 	}
 }
 
-// 🔔 ユーザーに通知を送信する補助関数
-func PublishToUser(redisClient *redis.Client, userID uint, payload map[string]interface{}) error {
-	data, err := json.Marshal(payload)
+// 接続中の端末一覧（全インスタンス分）
+func (h *NotifyWSHandler) ListSessions(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDAny.(uint)
+
+	sessions, err := notify.ListSessions(h.RedisClient, userID)
 	if err != nil {
-		return err
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get sessions"})
+		return
 	}
-	channel := fmt.Sprintf("user:%d", userID)
-	return redisClient.Publish(context.Background(), channel, data).Err()
+	c.JSON(http.StatusOK, sessions)
+}
+
+// 🔔 ユーザーに通知を送信する補助関数
+func PublishToUser(redisClient *redis.Client, userID uint, payload map[string]interface{}) error {
+	return notify.PublishToUser(redisClient, userID, payload)
 }
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"chat-app/internal/model"
+	"chat-app/internal/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// ルームWebSocketのプロトコルバージョン
+//
+//	v1: 受信はメッセージ本文のテキスト（または {"type": ...} のフラットなJSON）、
+//	    新着メッセージは Message のJSONをそのまま送信する旧形式
+//	v2: 送受信とも {v, type, id, payload} のエンベロープ。id 付きの受信フレームには ack / error を返す
+const (
+	protocolV1 = 1
+	protocolV2 = 2
+
+	latestProtocol = protocolV2
+
+	// Sec-WebSocket-Protocol で v2 を要求する場合の名前
+	subprotocolV2 = "chat.v2"
+)
+
+// 送受信フレーム
+type envelope struct {
+	V       int             `json:"v,omitempty"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`       // クライアント採番。ack / error で同じ値を返す
+	EventID string          `json:"event_id,omitempty"` // サーバーのイベントID（再接続時に ?since= で指定する）
+	Room    string          `json:"room,omitempty"`     // 多重化接続（/ws-mux）での対象ルーム
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// 受信イベントのペイロード
+type sendPayload struct {
+	Content       string      `json:"content"`
+	ParentID      *uint       `json:"parent_id"`      // スレッド返信先
+	AttachmentIDs []uuid.UUID `json:"attachment_ids"` // アップロード済みの添付ファイル
+	ClientID      string      `json:"client_id"`      // クライアント採番のID（再送の重複排除用）
+}
+
+// send の ack（楽観的に表示したメッセージとサーバー側のIDを対応付ける）
+type sendAck struct {
+	ID        uint           `json:"id"`
+	ClientID  *string        `json:"client_id,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	Duplicate bool           `json:"duplicate"` // 再送で、既に保存済みだった
+	Message   *model.Message `json:"message"`
+}
+
+type editPayload struct {
+	MessageID uint   `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+type deletePayload struct {
+	MessageID uint   `json:"message_id"`
+	Scope     string `json:"scope"` // "everyone"（既定） or "me"
+}
+
+type readPayload struct {
+	MessageID uint `json:"message_id"` // 省略時はルームの最新メッセージまで
+}
+
+type typingPayload struct {
+	Typing *bool `json:"typing"` // 省略時は true（入力中）、false で入力終了
+}
+
+// エラーフレームのペイロード
+type errorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// エラーコード
+const (
+	errCodeBadRequest         = "bad_request"
+	errCodeUnsupportedType    = "unsupported_type"
+	errCodeUnsupportedVersion = "unsupported_version"
+	errCodeForbidden          = "forbidden"
+	errCodeNotFound           = "not_found"
+	errCodeConflict           = "conflict"
+	errCodeInternal           = "internal"
+)
+
+// クライアントに返すエラー
+type wsError struct {
+	Code    string
+	Message string
+}
+
+func (e *wsError) Error() string { return e.Message }
+
+func badRequest(msg string) error {
+	return &wsError{Code: errCodeBadRequest, Message: msg}
+}
+
+// エラーをエラーフレームのペイロードに変換（想定外のエラーは内容を返さない）
+func toErrorPayload(err error) errorPayload {
+	var wsErr *wsError
+	switch {
+	case errors.As(err, &wsErr):
+		return errorPayload{Code: wsErr.Code, Message: wsErr.Message}
+	case errors.Is(err, service.ErrEmptyContent),
+		errors.Is(err, service.ErrInvalidParent),
+		errors.Is(err, service.ErrInvalidEmoji),
+		errors.Is(err, service.ErrInvalidAttachment),
+		errors.Is(err, service.ErrInvalidClientID),
+		errors.Is(err, service.ErrInvalidReadPosition):
+		return errorPayload{Code: errCodeBadRequest, Message: err.Error()}
+	case errors.Is(err, service.ErrMessageNotFound):
+		return errorPayload{Code: errCodeNotFound, Message: err.Error()}
+	case errors.Is(err, service.ErrNotMessageSender), errors.Is(err, service.ErrRoomAccessDenied):
+		return errorPayload{Code: errCodeForbidden, Message: err.Error()}
+	case errors.Is(err, service.ErrMessageDeleted):
+		return errorPayload{Code: errCodeConflict, Message: err.Error()}
+	default:
+		return errorPayload{Code: errCodeInternal, Message: "internal error"}
+	}
+}
+
+// Sec-WebSocket-Protocol で v2 が要求されているか
+func requestsSubprotocolV2(r *http.Request) bool {
+	for _, p := range websocket.Subprotocols(r) {
+		if p == subprotocolV2 {
+			return true
+		}
+	}
+	return false
+}
+
+// 接続時にプロトコルバージョンを決定
+// Sec-WebSocket-Protocol: chat.v2 か ?protocol=2 で v2、どちらもなければ v1（旧クライアント）
+func negotiateProtocol(r *http.Request) (int, error) {
+	if requestsSubprotocolV2(r) {
+		return protocolV2, nil
+	}
+
+	v := r.URL.Query().Get("protocol")
+	if v == "" {
+		return protocolV1, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < protocolV1 || version > latestProtocol {
+		return 0, errors.New("unsupported protocol version")
+	}
+	return version, nil
+}
+
+// ルームへ配信するイベント（接続ごとのプロトコルで変換して送信）
+type roomEvent struct {
+	EventID string // ログに残したイベントのみ
+	RoomID  string // 多重化接続のみ（v2 の room に入れる）
+	Type    string
+	Payload interface{}
+}
+
+// プロトコルに応じたフレームに変換
+func (ev roomEvent) render(protocol int) ([]byte, error) {
+	if protocol >= protocolV2 {
+		payload, err := json.Marshal(ev.Payload)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(envelope{V: protocolV2, Type: ev.Type, EventID: ev.EventID, Room: ev.RoomID, Payload: payload})
+	}
+
+	// v1: 新着メッセージは Message をそのまま、それ以外は {type, payload}
+	if ev.Type == "message" {
+		return json.Marshal(ev.Payload)
+	}
+	frame := map[string]interface{}{
+		"type":    ev.Type,
+		"payload": ev.Payload,
+	}
+	if ev.EventID != "" {
+		frame["event_id"] = ev.EventID
+	}
+	return json.Marshal(frame)
+}
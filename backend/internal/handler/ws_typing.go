@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// 「入力中」の表示を続ける時間（この間に再送がなければクライアント側で消す）
+	typingTTL = 5 * time.Second
+	// 「入力中」の中継間隔の下限（キー入力ごとの送信を間引く）
+	typingThrottle = 2 * time.Second
+)
+
+// 入力中シグナル（保存はしない）
+type typingEvent struct {
+	RoomID    uuid.UUID `json:"room_id"`
+	UserID    uint      `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Typing    bool      `json:"typing"`
+	ExpiresIn int64     `json:"expires_in"` // ミリ秒。typing=false なら 0
+}
+
+// 入力中を中継（間隔が短すぎるものは捨てる）
+func (h *WebSocketHandler) startTyping(s *wsSession) {
+	if !s.markTyping(time.Now()) {
+		return
+	}
+
+	h.publishTyping(typingEvent{
+		RoomID:    s.roomID,
+		UserID:    s.userID,
+		UserName:  s.userName,
+		Typing:    true,
+		ExpiresIn: typingTTL.Milliseconds(),
+	})
+}
+
+// 入力終了を中継（入力中を送っていて、まだ期限内の場合のみ）
+// 多重化接続では購読の取り消し（通知の転送ゴルーチン）からも呼ばれる
+func (h *WebSocketHandler) stopTyping(s *wsSession) {
+	if !s.clearTyping() {
+		return
+	}
+
+	h.publishTyping(typingEvent{
+		RoomID:   s.roomID,
+		UserID:   s.userID,
+		UserName: s.userName,
+		Typing:   false,
+	})
+}
+
+// 入力中の時刻を更新（前回の中継から間隔が短すぎれば false）
+func (s *wsSession) markTyping(now time.Time) bool {
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+
+	if now.Sub(s.typingAt) < typingThrottle {
+		return false
+	}
+	s.typingAt = now
+	return true
+}
+
+// 入力中を解除（入力中を送っていて、まだ期限内なら true）
+func (s *wsSession) clearTyping() bool {
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+
+	if s.typingAt.IsZero() {
+		return false
+	}
+	active := time.Since(s.typingAt) < typingTTL
+	s.typingAt = time.Time{}
+	return active
+}
+
+// 全インスタンスのルーム接続へ送信（本人の接続には返さない。再送用のログには残さない）
+func (h *WebSocketHandler) publishTyping(ev typingEvent) {
+	if err := h.Hub.PublishTransient(context.Background(), ev.RoomID.String(), "typing", ev, ev.UserID); err != nil {
+		log.Println("入力中シグナル送信失敗:", err)
+	}
+}
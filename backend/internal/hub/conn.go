@@ -0,0 +1,168 @@
+package hub
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// 1フレームの書き込みにかけられる時間
+	writeWait = 10 * time.Second
+	// この時間 pong（または何らかの受信）がなければ切断
+	pongWait = 60 * time.Second
+	// ping の送信間隔（pongWait より短くする）
+	pingPeriod = pongWait * 9 / 10
+	// 受信フレームの最大サイズ
+	maxMessageSize = 64 * 1024
+	// 送信キューの長さ（溢れたら遅いクライアントとして切断）
+	sendQueueSize = 256
+)
+
+// 切断理由
+const (
+	closeReasonClient      = "client"
+	closeReasonSlow        = "slow_consumer"
+	closeReasonWriteError  = "write_error"
+	closeReasonPongTimeout = "pong_timeout"
+	closeReasonServer      = "server"
+)
+
+// WebSocket の接続
+// 書き込みは専用のゴルーチンだけが行い、他からは送信キューに積むだけにする
+// （配信側が遅い接続やロックで詰まらないように）
+type Conn struct {
+	ws   *websocket.Conn
+	kind string // メトリクスの区分（"room" / "notify"）
+
+	send chan []byte
+	done chan struct{}
+
+	closeOnce sync.Once
+	reason    string
+}
+
+func NewConn(ws *websocket.Conn, kind string) *Conn {
+	c := &Conn{
+		ws:   ws,
+		kind: kind,
+		send: make(chan []byte, sendQueueSize),
+		done: make(chan struct{}),
+	}
+	connOpened(kind)
+	return c
+}
+
+// 送信キューに積む（キューが一杯なら接続を切って false）
+func (c *Conn) Enqueue(data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- data:
+		return true
+	default:
+		c.closeWith(closeReasonSlow)
+		return false
+	}
+}
+
+// 切断（書き込みゴルーチンが close フレームを送って接続を閉じる）
+func (c *Conn) Close() {
+	c.closeWith(closeReasonServer)
+}
+
+// 切断を通知するチャンネル
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Conn) closeWith(reason string) {
+	c.closeOnce.Do(func() {
+		c.reason = reason
+		close(c.done)
+		// 読み込み中の ReadMessage を止める
+		c.ws.SetReadDeadline(time.Now())
+	})
+}
+
+// 書き込みゴルーチンを起動して、切断まで受信フレームを onMessage に渡す
+func (c *Conn) Run(onMessage func(data []byte)) {
+	finished := make(chan struct{})
+	go func() {
+		c.writePump()
+		close(finished)
+	}()
+
+	c.readPump(onMessage)
+
+	<-finished
+	c.ws.Close()
+	connClosed(c.kind, c.reason)
+}
+
+func (c *Conn) readPump(onMessage func(data []byte)) {
+	c.ws.SetReadLimit(maxMessageSize)
+	c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				c.closeWith(closeReasonPongTimeout)
+			} else {
+				c.closeWith(closeReasonClient)
+			}
+			return
+		}
+		// pong 以外の受信でも生存確認とみなす
+		c.ws.SetReadDeadline(time.Now().Add(pongWait))
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		onMessage(data)
+	}
+}
+
+func (c *Conn) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.closeWith(closeReasonWriteError)
+				return
+			}
+		case <-ticker.C:
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.closeWith(closeReasonWriteError)
+				return
+			}
+		case <-c.done:
+			code := websocket.CloseNormalClosure
+			if c.reason == closeReasonSlow {
+				code = websocket.ClosePolicyViolation
+			}
+			msg := websocket.FormatCloseMessage(code, c.reason)
+			c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+			return
+		}
+	}
+}
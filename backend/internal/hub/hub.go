@@ -0,0 +1,160 @@
+package hub
+
+import (
+	"chat-app/internal/eventlog"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// ルームのイベントを中継する Redis チャンネル（room:<room_id>）
+	roomChannelPrefix = "room:"
+	// 再接続時の再送用ログ（roomlog:<room_id>）
+	roomLogPrefix = "roomlog:"
+)
+
+// ルームへ配信するイベント
+type Event struct {
+	ID            string          `json:"id,omitempty"` // イベントログのID（入力中など記録しないイベントは空）
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	ExcludeUserID uint            `json:"exclude_user_id,omitempty"` // このユーザーの接続には送らない（入力中など）
+}
+
+// イベントの配信先（WebSocket の接続など）
+type Client interface {
+	Send(ev Event)
+}
+
+// ルーム単位のファンアウト
+// 送信は必ず Redis を経由し、購読で受け取ったものだけを配信する（自インスタンス宛ても同様）
+// これによりインスタンス数に関係なく、各接続に1回ずつ届く
+type Hub struct {
+	rdb *redis.Client
+
+	mu    sync.RWMutex
+	rooms map[string]map[Client]uint // room_id → 接続 → ユーザーID
+}
+
+func New(rdb *redis.Client) *Hub {
+	return &Hub{
+		rdb:   rdb,
+		rooms: make(map[string]map[Client]uint),
+	}
+}
+
+// Redis の購読を開始（購読が確立してから戻る）
+func (h *Hub) Start(ctx context.Context) error {
+	pubsub := h.rdb.PSubscribe(ctx, roomChannelPrefix+"*")
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			var ev Event
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+				log.Println("ルームイベントの解析に失敗:", err)
+				continue
+			}
+			h.deliver(strings.TrimPrefix(msg.Channel, roomChannelPrefix), ev)
+		}
+	}()
+	return nil
+}
+
+// ルームに接続を登録
+func (h *Hub) Join(roomID string, userID uint, c Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.rooms[roomID] == nil {
+		h.rooms[roomID] = make(map[Client]uint)
+	}
+	h.rooms[roomID][c] = userID
+}
+
+// ルームから接続を外す
+func (h *Hub) Leave(roomID string, c Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.rooms[roomID], c)
+	if len(h.rooms[roomID]) == 0 {
+		delete(h.rooms, roomID)
+	}
+}
+
+// 全インスタンスのルーム接続へイベントを送信（ログに残し、再接続時に再送できるようにする）
+func (h *Hub) Publish(ctx context.Context, roomID string, eventType string, payload interface{}, excludeUserID uint) error {
+	return h.publish(ctx, roomID, eventType, payload, excludeUserID, true)
+}
+
+// ログに残さずに送信（入力中など、再送しても意味のないイベント）
+func (h *Hub) PublishTransient(ctx context.Context, roomID string, eventType string, payload interface{}, excludeUserID uint) error {
+	return h.publish(ctx, roomID, eventType, payload, excludeUserID, false)
+}
+
+func (h *Hub) publish(ctx context.Context, roomID string, eventType string, payload interface{}, excludeUserID uint, logged bool) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ev := Event{Type: eventType, Payload: raw, ExcludeUserID: excludeUserID}
+
+	if logged {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if ev.ID, err = eventlog.Append(ctx, h.rdb, roomLogPrefix+roomID, data); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return h.rdb.Publish(ctx, roomChannelPrefix+roomID, data).Err()
+}
+
+// since より後にルームへ送信されたイベント（古い順）
+// ログが切り詰められていれば eventlog.ErrTooFarBehind
+func (h *Hub) Replay(ctx context.Context, roomID string, since string) ([]Event, error) {
+	entries, err := eventlog.Since(ctx, h.rdb, roomLogPrefix+roomID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(entries))
+	for _, e := range entries {
+		var ev Event
+		if err := json.Unmarshal([]byte(e.Data), &ev); err != nil {
+			continue
+		}
+		ev.ID = e.ID
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// このインスタンスの接続へ配信
+func (h *Hub) deliver(roomID string, ev Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for c, userID := range h.rooms[roomID] {
+		if ev.ExcludeUserID != 0 && userID == ev.ExcludeUserID {
+			continue
+		}
+		c.Send(ev)
+	}
+}
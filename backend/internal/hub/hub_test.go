@@ -0,0 +1,162 @@
+package hub_test
+
+import (
+	"chat-app/internal/hub"
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// 受け取ったイベントを記録するだけの接続
+type fakeConn struct {
+	mu     sync.Mutex
+	events []hub.Event
+}
+
+func (c *fakeConn) Send(ev hub.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, ev)
+}
+
+func (c *fakeConn) received() []hub.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]hub.Event(nil), c.events...)
+}
+
+// ローカルの Redis（REDIS_URL、なければ localhost:6379）に接続できなければスキップ
+func newRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		url = "redis://localhost:6379/0"
+	}
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		t.Skipf("invalid REDIS_URL: %v", err)
+	}
+	rdb := redis.NewClient(opt)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		t.Skipf("redis is not available: %v", err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// 2つのインスタンスに分かれた接続へ、どちらから送っても各イベントがちょうど1回ずつ届く
+func TestPublishAcrossInstances(t *testing.T) {
+	rdbA := newRedis(t)
+	rdbB := newRedis(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hubA := hub.New(rdbA)
+	hubB := hub.New(rdbB)
+	if err := hubA.Start(ctx); err != nil {
+		t.Fatalf("start hub A: %v", err)
+	}
+	if err := hubB.Start(ctx); err != nil {
+		t.Fatalf("start hub B: %v", err)
+	}
+
+	roomID := uuid.NewString()
+	t.Cleanup(func() { rdbA.Del(context.Background(), "roomlog:"+roomID) })
+
+	connA := &fakeConn{}
+	connB := &fakeConn{}
+	hubA.Join(roomID, 1, connA)
+	hubB.Join(roomID, 2, connB)
+
+	// 記録するイベントと記録しないイベントを両方のインスタンスから送る
+	const total = 4
+	if err := hubA.Publish(ctx, roomID, "message", map[string]int{"n": 1}, 0); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := hubB.Publish(ctx, roomID, "message", map[string]int{"n": 2}, 0); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := hubA.PublishTransient(ctx, roomID, "typing", map[string]int{"n": 3}, 0); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := hubB.Publish(ctx, roomID, "message", map[string]int{"n": 4}, 0); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	for _, c := range []*fakeConn{connA, connB} {
+		waitFor(t, func() bool { return len(c.received()) >= total })
+	}
+	// 重複して届くものがないか、少し待ってから数える
+	time.Sleep(200 * time.Millisecond)
+
+	for name, c := range map[string]*fakeConn{"A": connA, "B": connB} {
+		events := c.received()
+		if len(events) != total {
+			t.Fatalf("conn %s: got %d events, want %d", name, len(events), total)
+		}
+		seen := make(map[string]int)
+		for _, ev := range events {
+			seen[string(ev.Payload)]++
+		}
+		for payload, n := range seen {
+			if n != 1 {
+				t.Errorf("conn %s: event %s delivered %d times", name, payload, n)
+			}
+		}
+	}
+}
+
+// ExcludeUserID のユーザーの接続には、どのインスタンスでも届かない
+func TestPublishExcludesUser(t *testing.T) {
+	rdbA := newRedis(t)
+	rdbB := newRedis(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hubA := hub.New(rdbA)
+	hubB := hub.New(rdbB)
+	if err := hubA.Start(ctx); err != nil {
+		t.Fatalf("start hub A: %v", err)
+	}
+	if err := hubB.Start(ctx); err != nil {
+		t.Fatalf("start hub B: %v", err)
+	}
+
+	roomID := uuid.NewString()
+
+	sender := &fakeConn{}
+	other := &fakeConn{}
+	hubA.Join(roomID, 1, other)
+	hubB.Join(roomID, 2, sender)
+
+	if err := hubA.PublishTransient(ctx, roomID, "typing", map[string]uint{"user_id": 2}, 2); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	waitFor(t, func() bool { return len(other.received()) == 1 })
+	time.Sleep(200 * time.Millisecond)
+	if n := len(sender.received()); n != 0 {
+		t.Fatalf("excluded user received %d events", n)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for events")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,25 @@
+package hub
+
+import "expvar"
+
+// WebSocket 接続のメトリクス（/debug/vars の "websocket" に出る。expvar の他の値は公開しない）
+//
+//	<kind>_active          接続中の数
+//	<kind>_opened          累計接続数
+//	<kind>_closed_<reason> 切断理由ごとの累計（slow_consumer / write_error / pong_timeout など）
+var metrics = expvar.NewMap("websocket")
+
+// 内部向けの /debug/vars で返す JSON（{"websocket": {...}}）
+func MetricsJSON() string {
+	return `{"websocket": ` + metrics.String() + `}`
+}
+
+func connOpened(kind string) {
+	metrics.Add(kind+"_active", 1)
+	metrics.Add(kind+"_opened", 1)
+}
+
+func connClosed(kind string, reason string) {
+	metrics.Add(kind+"_active", -1)
+	metrics.Add(kind+"_closed_"+reason, 1)
+}
@@ -0,0 +1,35 @@
+package infra
+
+import (
+	"chat-app/internal/storage"
+	"log"
+	"os"
+)
+
+// STORAGE_DRIVER に応じて添付ファイルの保存先を作成（既定はローカル）
+func NewStorage() storage.Storage {
+	switch os.Getenv("STORAGE_DRIVER") {
+	case "s3":
+		s, err := storage.NewS3Storage(storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+		if err != nil {
+			log.Fatalf("invalid s3 storage config: %v", err)
+		}
+		return s
+	default:
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		s, err := storage.NewLocalStorage(dir)
+		if err != nil {
+			log.Fatalf("failed to prepare local storage: %v", err)
+		}
+		return s
+	}
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Attachment struct {
+	ID           uuid.UUID `json:"id"`
+	MessageID    *uint     `json:"message_id"` // 送信前は null
+	RoomID       uuid.UUID `json:"room_id"`
+	UploaderID   uint      `json:"uploader_id"`
+	FileName     string    `json:"file_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	StorageKey   string    `json:"-"`
+	ThumbnailKey *string   `json:"-"`
+	Width        *int      `json:"width"`  // 画像のみ
+	Height       *int      `json:"height"` // 画像のみ
+	CreatedAt    time.Time `json:"created_at"`
+
+	// 署名付きダウンロードURL（レスポンス時に付与）
+	URL          string `json:"url" gorm:"-"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty" gorm:"-"`
+}
@@ -6,11 +6,65 @@ import (
 	"github.com/google/uuid"
 )
 
+// 全員から削除されたメッセージの本文
+const DeletedMessageContent = "このメッセージは削除されました"
+
+// メッセージの種類
+const (
+	MessageKindText   = "text"
+	MessageKindSystem = "system" // メンバーの追加・削除などの記録（編集・削除不可）
+)
+
+// 1対1ルームの配信状況
+const (
+	MessageStatusSent      = "sent"      // 送信済み
+	MessageStatusDelivered = "delivered" // 相手の端末に届いた
+	MessageStatusRead      = "read"      // 相手が読んだ
+)
+
 type Message struct {
     ID        uint      `json:"id"`
     RoomID    uuid.UUID `json:"room_id"`
     SenderID  uint      `json:"sender_id"` 
     Sender    string    `json:"sender"`
     Content   string    `json:"content"`
+    Kind      string    `json:"kind" gorm:"default:text"`
     CreatedAt time.Time `json:"created_at"`
+    EditedAt  *time.Time `json:"edited_at"` // 未編集なら null
+    DeletedAt *time.Time `json:"deleted_at"` // 全員から削除済みなら日時
+    ParentID  *uint     `json:"parent_id"`  // スレッド返信なら親メッセージID
+    ClientID  *string   `json:"client_id,omitempty"` // クライアント採番のID（再送の重複排除用）
+
+    // 配信状況（1対1ルームのみ記録・更新は専用のクエリで行う）
+    DeliveredAt *time.Time `json:"delivered_at,omitempty" gorm:"->"`
+    ReadAt      *time.Time `json:"read_at,omitempty" gorm:"->"`
+    Status      string     `json:"status,omitempty" gorm:"-"`
+
+    // スレッド情報（集計値・読み取り専用）
+    ReplyCount  int        `json:"reply_count" gorm:"->"`
+    LastReplyAt *time.Time `json:"last_reply_at" gorm:"->"`
+
+    // リアクション集計（閲覧ユーザーごとに付与）
+    Reactions []ReactionSummary `json:"reactions" gorm:"-"`
+
+    // メンションされたユーザーID（@all の場合は送信者以外の全メンバー）
+    Mentions    []uint `json:"mentions" gorm:"-"`
+    MentionAll  bool   `json:"mention_all" gorm:"-"`
+
+    // 添付ファイル
+    Attachments []Attachment `json:"attachments" gorm:"-"`
+}
+
+// 配信・既読の日時から配信状況を設定（1対1ルームのメッセージに使う）
+func SetDeliveryStatus(messages []Message) {
+	for i := range messages {
+		switch {
+		case messages[i].ReadAt != nil:
+			messages[i].Status = MessageStatusRead
+		case messages[i].DeliveredAt != nil:
+			messages[i].Status = MessageStatusDelivered
+		default:
+			messages[i].Status = MessageStatusSent
+		}
+	}
 }
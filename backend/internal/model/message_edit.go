@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// メッセージの編集履歴（編集前の内容）
+type MessageEdit struct {
+	ID        uint      `json:"id"`
+	MessageID uint      `json:"message_id"`
+	Content   string    `json:"content"`
+	EditedAt  time.Time `json:"edited_at"`
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// 「自分だけ削除」したメッセージ
+type MessageHide struct {
+	MessageID uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"primaryKey"`
+	HiddenAt  time.Time `gorm:"not null"`
+}
@@ -0,0 +1,8 @@
+package model
+
+// メッセージ内でメンションされたユーザー
+type MessageMention struct {
+	MessageID uint `gorm:"primaryKey" json:"message_id"`
+	UserID    uint `gorm:"primaryKey" json:"user_id"`
+	IsAll     bool `gorm:"not null" json:"is_all"` // @all のみによるメンション（名前でも指定されていれば false）
+}
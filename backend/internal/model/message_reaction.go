@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// ユーザーごとのリアクション
+type MessageReaction struct {
+	MessageID uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"primaryKey"`
+	Emoji     string    `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// 絵文字ごとの集計（メッセージ一覧で返す）
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
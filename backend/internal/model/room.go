@@ -6,6 +6,12 @@ import (
 	"github.com/google/uuid"
 )
 
+// 公開範囲
+const (
+	RoomVisibilityPrivate = "private" // メンバーのみ
+	RoomVisibilityPublic  = "public"  // チャンネル一覧に表示され、誰でも参加できる
+)
+
 type Room struct {
     ID        uuid.UUID    `json:"id"`
     Name      string    `json:"name"`           // グループ名 or 空
@@ -13,4 +19,7 @@ type Room struct {
     IsGroup   bool      `json:"is_group"`       // true: グループ, false: 1対1
     CreatedAt time.Time `json:"created_at"`
     LastMessage  string    `json:"last_message"` 
+    Visibility  string `json:"visibility" gorm:"default:private"`
+    Topic       string `json:"topic"`       // チャンネルのトピック
+    Description string `json:"description"` // チャンネルの説明
 }
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RoomInvite struct {
+	ID        uint       `json:"id"`
+	RoomID    uuid.UUID  `json:"room_id"`
+	Token     string     `json:"token"`
+	CreatedBy uint       `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"` // null なら無期限
+	MaxUses   *int       `json:"max_uses"`   // null なら回数無制限
+	UseCount  int        `json:"use_count"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// 今使える招待か（取り消し・期限切れ・回数超過でない）
+func (i *RoomInvite) Usable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !now.Before(*i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == nil || i.UseCount < *i.MaxUses
+}
+
+// 招待リンクからの参加の記録（退会して同じ招待で再参加すれば、もう1件記録する）
+type RoomInviteUse struct {
+	ID       uint      `json:"id"`
+	InviteID uint      `json:"invite_id"`
+	UserID   uint      `json:"user_id"`
+	JoinedAt time.Time `json:"joined_at"`
+}
@@ -1,8 +1,41 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ルーム内の役割（グループのみ。1対1ルームは両者とも member）
+const (
+	RoomRoleOwner  = "owner"
+	RoomRoleAdmin  = "admin"
+	RoomRoleMember = "member"
+)
+
+// ルームごとの通知設定
+const (
+	NotifyLevelAll      = "all"      // すべてのメッセージを通知
+	NotifyLevelMentions = "mentions" // 自分宛てのメンション（@all を含む）のみ
+	NotifyLevelMuted    = "muted"    // 通知しない
+)
 
 type RoomMember struct {
-    RoomID uuid.UUID `json:"room_id"`
-    UserID uint   `json:"user_id"`
+    RoomID   uuid.UUID `json:"room_id"`
+    UserID   uint      `json:"user_id"`
+    Role     string    `json:"role" gorm:"default:member"`
+    JoinedAt time.Time `json:"joined_at" gorm:"default:now()"`
+    NotifyLevel string     `json:"notify_level" gorm:"default:all"`
+    MutedUntil  *time.Time `json:"muted_until"` // 期限付きミュートの終了時刻
+}
+
+// 期限切れのミュートを all として扱った通知設定
+func EffectiveNotifyLevel(level string, mutedUntil *time.Time, now time.Time) string {
+    if level == "" {
+        return NotifyLevelAll
+    }
+    if level == NotifyLevelMuted && mutedUntil != nil && !mutedUntil.After(now) {
+        return NotifyLevelAll
+    }
+    return level
 }
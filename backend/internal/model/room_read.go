@@ -3,7 +3,8 @@ package model
 import "time"
 
 type RoomRead struct {
-	UserID     uint      `gorm:"primaryKey"`
-	RoomID     string    `gorm:"primaryKey"`
-	LastReadAt time.Time `gorm:"not null"`
+	UserID            uint      `gorm:"primaryKey"`
+	RoomID            string    `gorm:"primaryKey"`
+	LastReadAt        time.Time `gorm:"not null"` // 既読位置を最後に進めた時刻
+	LastReadMessageID *uint     // どのメッセージまで読んだか（戻ることはない）
 }
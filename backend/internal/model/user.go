@@ -9,6 +9,10 @@ type User struct {
     Password string `json:"-"`
     CreatedAt time.Time `json:"-"`
     UpdatedAt time.Time `json:"-"`
+
+    // オンライン状態（online / away / offline）
+    Presence   string     `json:"presence,omitempty" gorm:"-"`
+    LastSeenAt *time.Time `json:"last_seen_at,omitempty" gorm:"-"`
 }
 
 
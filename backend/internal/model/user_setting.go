@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+type UserSetting struct {
+	UserID              uint      `json:"-" gorm:"primaryKey"`
+	ReadReceiptsEnabled bool      `json:"read_receipts_enabled"` // false なら既読を他のメンバーに知らせない
+	UpdatedAt           time.Time `json:"updated_at"`
+}
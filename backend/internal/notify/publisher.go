@@ -1,6 +1,7 @@
 package notify
 
 import (
+	"chat-app/internal/eventlog"
 	"context"
 	"encoding/json"
 	"strconv"
@@ -10,11 +11,87 @@ import (
 
 var ctx = context.Background()
 
+// 再接続時の再送用ログ（userlog:<user_id>）
+const userLogPrefix = "userlog:"
+
+// 通知を送信（ログに残し、event_id を付けて配信する）
 func PublishToUser(rdb *redis.Client, userID uint, data map[string]interface{}) error {
 	payload, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
+	eventID, err := eventlog.Append(ctx, rdb, userLogKey(userID), payload)
+	if err != nil {
+		return err
+	}
+
+	payload, err = withEventID(payload, eventID)
+	if err != nil {
+		return err
+	}
 	channel := "user:" + strconv.Itoa(int(userID))
 	return rdb.Publish(ctx, channel, payload).Err()
 }
+
+// since より後の通知（古い順、event_id 付き）
+// ログが切り詰められていれば eventlog.ErrTooFarBehind
+func Replay(rdb *redis.Client, userID uint, since string) ([]string, error) {
+	entries, err := eventlog.Since(ctx, rdb, userLogKey(userID), since)
+	if err != nil {
+		return nil, err
+	}
+	return toPayloads(entries), nil
+}
+
+// since より後の通知を最大 count 件（古い順、event_id 付き。since が空なら先頭から）
+func After(rdb *redis.Client, userID uint, since string, count int64) ([]string, error) {
+	entries, err := eventlog.After(ctx, rdb, userLogKey(userID), since, count)
+	if err != nil {
+		return nil, err
+	}
+	return toPayloads(entries), nil
+}
+
+func toPayloads(entries []eventlog.Entry) []string {
+	payloads := make([]string, 0, len(entries))
+	for _, e := range entries {
+		payload, err := withEventID([]byte(e.Data), e.ID)
+		if err != nil {
+			continue
+		}
+		payloads = append(payloads, string(payload))
+	}
+	return payloads
+}
+
+// 送信済みの通知（ログから消えていれば空）
+func Lookup(rdb *redis.Client, userID uint, eventID string) (string, error) {
+	return eventlog.Get(ctx, rdb, userLogKey(userID), eventID)
+}
+
+// 最新の通知の event_id（なければ空）
+func LatestEventID(rdb *redis.Client, userID uint) (string, error) {
+	return eventlog.Latest(ctx, rdb, userLogKey(userID))
+}
+
+// 通知の event_id を取り出す（なければ空）
+func EventID(payload string) string {
+	var v struct {
+		EventID string `json:"event_id"`
+	}
+	json.Unmarshal([]byte(payload), &v)
+	return v.EventID
+}
+
+func userLogKey(userID uint) string {
+	return userLogPrefix + strconv.Itoa(int(userID))
+}
+
+func withEventID(payload []byte, eventID string) ([]byte, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, err
+	}
+	data["event_id"] = eventID
+	return json.Marshal(data)
+}
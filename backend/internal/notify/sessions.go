@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// 接続中セッションの Redis ハッシュ（sessions:<user_id> → session_id → Session）
+	sessionKeyPrefix = "sessions:"
+	// last_seen_at の更新間隔
+	SessionHeartbeat = 30 * time.Second
+	// この時間更新がないセッションは切断済み（インスタンスが落ちた場合など）とみなす
+	sessionStaleAfter = 3 * SessionHeartbeat
+)
+
+// 通知WebSocketの接続（端末）
+type Session struct {
+	ID          string    `json:"id"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+func sessionKey(userID uint) string {
+	return sessionKeyPrefix + strconv.Itoa(int(userID))
+}
+
+// セッションを登録（再登録で last_seen_at を更新）
+func SaveSession(rdb *redis.Client, userID uint, s Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	key := sessionKey(userID)
+	if err := rdb.HSet(ctx, key, s.ID, data).Err(); err != nil {
+		return err
+	}
+	// 全端末が切断されたまま放置されたハッシュは消える
+	return rdb.Expire(ctx, key, sessionStaleAfter).Err()
+}
+
+func RemoveSession(rdb *redis.Client, userID uint, sessionID string) error {
+	return rdb.HDel(ctx, sessionKey(userID), sessionID).Err()
+}
+
+// 接続中のセッション一覧（接続の新しい順）。期限切れのものは削除する
+func ListSessions(rdb *redis.Client, userID uint) ([]Session, error) {
+	key := sessionKey(userID)
+	entries, err := rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := []Session{}
+	for id, raw := range entries {
+		var s Session
+		if err := json.Unmarshal([]byte(raw), &s); err != nil || now.Sub(s.LastSeenAt) > sessionStaleAfter {
+			rdb.HDel(ctx, key, id)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ConnectedAt.After(sessions[j].ConnectedAt)
+	})
+	return sessions, nil
+}
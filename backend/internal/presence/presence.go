@@ -0,0 +1,186 @@
+package presence
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// オンライン状態
+// 接続（/ws, /ws-notify など）ごとに期限付きで登録し、ハートビートで延長する
+// インスタンスが落ちて切断処理が走らなくても、期限が切れればオフラインになる
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away" // 接続はあるが、しばらく操作がない
+	StatusOffline = "offline"
+
+	// ハートビートの間隔
+	Heartbeat = 30 * time.Second
+	// 接続の有効期限（ハートビートが途切れてからオフラインになるまで）
+	connTTL = 3 * Heartbeat
+	// 最後の操作からこの時間で離席中
+	awayAfter = 5 * time.Minute
+
+	connsKeyPrefix      = "presence:conns:"       // ユーザーごとの接続（ZSET: 接続ID → 期限のミリ秒）
+	lastSeenKeyPrefix   = "presence:last_seen:"   // 最後に接続があった時刻（ミリ秒）
+	lastActiveKeyPrefix = "presence:last_active:" // 最後に操作した時刻（ミリ秒）
+	statusKeyPrefix     = "presence:status:"      // 最後に通知した状態（変化の検出用）
+	trackedKey          = "presence:tracked"      // 接続のあるユーザー（ZSET: ユーザーID → 接続の期限のミリ秒）
+)
+
+type Presence struct {
+	Status     string     `json:"status"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+var ctx = context.Background()
+
+func key(prefix string, userID uint) string {
+	return prefix + strconv.FormatUint(uint64(userID), 10)
+}
+
+// 接続を登録（状態が変わった場合は changed が true）
+func Connect(rdb *redis.Client, userID uint, connID string) (Presence, bool, error) {
+	now := time.Now()
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, key(connsKeyPrefix, userID), redis.Z{Score: float64(now.Add(connTTL).UnixMilli()), Member: connID})
+	pipe.ZRemRangeByScore(ctx, key(connsKeyPrefix, userID), "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	pipe.Expire(ctx, key(connsKeyPrefix, userID), connTTL)
+	pipe.ZAddGT(ctx, trackedKey, redis.Z{Score: float64(now.Add(connTTL).UnixMilli()), Member: userID})
+	pipe.Set(ctx, key(lastSeenKeyPrefix, userID), now.UnixMilli(), 0)
+	pipe.Set(ctx, key(lastActiveKeyPrefix, userID), now.UnixMilli(), 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Presence{}, false, err
+	}
+	return refresh(rdb, userID)
+}
+
+// 接続の期限を延長（操作がなければ離席中に変わる）
+func Beat(rdb *redis.Client, userID uint, connID string) (Presence, bool, error) {
+	now := time.Now()
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, key(connsKeyPrefix, userID), redis.Z{Score: float64(now.Add(connTTL).UnixMilli()), Member: connID})
+	pipe.ZRemRangeByScore(ctx, key(connsKeyPrefix, userID), "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	pipe.Expire(ctx, key(connsKeyPrefix, userID), connTTL)
+	pipe.ZAddGT(ctx, trackedKey, redis.Z{Score: float64(now.Add(connTTL).UnixMilli()), Member: userID})
+	pipe.Set(ctx, key(lastSeenKeyPrefix, userID), now.UnixMilli(), 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Presence{}, false, err
+	}
+	return refresh(rdb, userID)
+}
+
+// 操作を記録（離席中からオンラインに戻る）
+func Touch(rdb *redis.Client, userID uint) (Presence, bool, error) {
+	if err := rdb.Set(ctx, key(lastActiveKeyPrefix, userID), time.Now().UnixMilli(), 0).Err(); err != nil {
+		return Presence{}, false, err
+	}
+	return refresh(rdb, userID)
+}
+
+// 接続を削除（最後の接続ならオフラインになる）
+func Disconnect(rdb *redis.Client, userID uint, connID string) (Presence, bool, error) {
+	pipe := rdb.TxPipeline()
+	pipe.ZRem(ctx, key(connsKeyPrefix, userID), connID)
+	pipe.Set(ctx, key(lastSeenKeyPrefix, userID), time.Now().UnixMilli(), 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Presence{}, false, err
+	}
+	return refresh(rdb, userID)
+}
+
+// 接続の期限が切れたユーザーの状態を計算し直し、変わったものを返す
+// 落ちたインスタンスの接続は切断処理が走らないため、定期的に呼んでオフラインを通知する
+// 複数のインスタンスが呼んでも、変化を返すのはどれか1つだけ
+func Sweep(rdb *redis.Client) (map[uint]Presence, error) {
+	nowMs := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	members, err := rdb.ZRangeByScore(ctx, trackedKey, &redis.ZRangeBy{Min: "-inf", Max: nowMs}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[uint]Presence)
+	for _, m := range members {
+		id, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			rdb.ZRem(ctx, trackedKey, m)
+			continue
+		}
+		userID := uint(id)
+		p, ok, err := refresh(rdb, userID)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed[userID] = p
+		}
+		// オフラインなら対象から外す（直後に接続しても、ハートビートで登録し直される）
+		if p.Status == StatusOffline {
+			rdb.ZRem(ctx, trackedKey, m)
+		}
+	}
+	return changed, nil
+}
+
+// 複数ユーザーの状態をまとめて取得
+func GetMany(rdb *redis.Client, userIDs []uint) (map[uint]Presence, error) {
+	now := time.Now()
+	nowMs := strconv.FormatInt(now.UnixMilli(), 10)
+
+	pipe := rdb.Pipeline()
+	counts := make([]*redis.IntCmd, len(userIDs))
+	lastSeen := make([]*redis.StringCmd, len(userIDs))
+	lastActive := make([]*redis.StringCmd, len(userIDs))
+	for i, id := range userIDs {
+		counts[i] = pipe.ZCount(ctx, key(connsKeyPrefix, id), "("+nowMs, "+inf")
+		lastSeen[i] = pipe.Get(ctx, key(lastSeenKeyPrefix, id))
+		lastActive[i] = pipe.Get(ctx, key(lastActiveKeyPrefix, id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	result := make(map[uint]Presence, len(userIDs))
+	for i, id := range userIDs {
+		result[id] = evaluate(now, counts[i].Val(), lastSeen[i].Val(), lastActive[i].Val())
+	}
+	return result, nil
+}
+
+// 現在の状態を計算し、前回通知した状態と違えば更新して changed を返す
+func refresh(rdb *redis.Client, userID uint) (Presence, bool, error) {
+	states, err := GetMany(rdb, []uint{userID})
+	if err != nil {
+		return Presence{}, false, err
+	}
+	p := states[userID]
+
+	prev, err := rdb.GetSet(ctx, key(statusKeyPrefix, userID), p.Status).Result()
+	if err != nil && err != redis.Nil {
+		return p, false, err
+	}
+	// 初回（記録なし）はオフラインから変わったものとみなす
+	if prev == "" {
+		prev = StatusOffline
+	}
+	return p, prev != p.Status, nil
+}
+
+func evaluate(now time.Time, conns int64, lastSeen string, lastActive string) Presence {
+	p := Presence{Status: StatusOffline}
+	if ms, err := strconv.ParseInt(lastSeen, 10, 64); err == nil {
+		t := time.UnixMilli(ms)
+		p.LastSeenAt = &t
+	}
+	if conns == 0 {
+		return p
+	}
+
+	p.Status = StatusOnline
+	if ms, err := strconv.ParseInt(lastActive, 10, 64); err == nil && now.Sub(time.UnixMilli(ms)) >= awayAfter {
+		p.Status = StatusAway
+	}
+	return p
+}
@@ -0,0 +1,68 @@
+package presence
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ローカルの Redis（REDIS_URL、なければ localhost:6379）に接続できなければスキップ
+func newRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		url = "redis://localhost:6379/0"
+	}
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		t.Skipf("invalid REDIS_URL: %v", err)
+	}
+	rdb := redis.NewClient(opt)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		t.Skipf("redis is not available: %v", err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// 切断処理が走らないまま接続の期限が切れると、Sweep が1回だけオフラインを返す
+func TestSweepReportsExpiredConnections(t *testing.T) {
+	rdb := newRedis(t)
+	userID := uint(time.Now().UnixNano()%1_000_000_000) + 1_000_000_000
+	t.Cleanup(func() {
+		rdb.Del(ctx, key(connsKeyPrefix, userID), key(lastSeenKeyPrefix, userID),
+			key(lastActiveKeyPrefix, userID), key(statusKeyPrefix, userID))
+		rdb.ZRem(ctx, trackedKey, strconv.FormatUint(uint64(userID), 10))
+	})
+
+	p, changed, err := Connect(rdb, userID, "conn-1")
+	if err != nil || !changed || p.Status != StatusOnline {
+		t.Fatalf("connect = %+v, %v, %v", p, changed, err)
+	}
+	if got, err := Sweep(rdb); err != nil || len(got) != 0 {
+		t.Fatalf("sweep while connected = %+v, %v", got, err)
+	}
+
+	// インスタンスが落ちたとみなし、接続の期限を過去にする
+	past := float64(time.Now().Add(-time.Second).UnixMilli())
+	rdb.ZAdd(ctx, key(connsKeyPrefix, userID), redis.Z{Score: past, Member: "conn-1"})
+	rdb.ZAdd(ctx, trackedKey, redis.Z{Score: past, Member: userID})
+
+	got, err := Sweep(rdb)
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if p, ok := got[userID]; !ok || p.Status != StatusOffline {
+		t.Fatalf("sweep = %+v, want %d offline", got, userID)
+	}
+	if got, err := Sweep(rdb); err != nil || len(got) != 0 {
+		t.Fatalf("second sweep = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"chat-app/internal/model"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 紐付けようとした添付ファイルが、既に他のメッセージに紐付けられていた（同時送信など）
+var ErrAttachmentUnavailable = errors.New("attachment is no longer linkable")
+
+type AttachmentRepository struct {
+	DB *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{DB: db}
+}
+
+func (r *AttachmentRepository) Create(attachment *model.Attachment) error {
+	return r.DB.Create(attachment).Error
+}
+
+// IDから添付ファイル取得（存在しなければ nil）
+func (r *AttachmentRepository) FindByID(id uuid.UUID) (*model.Attachment, error) {
+	var attachment model.Attachment
+	err := r.DB.First(&attachment, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// 送信前（未紐付け）の自分がアップロードした添付ファイル数
+func (r *AttachmentRepository) CountLinkable(ids []uuid.UUID, roomID uuid.UUID, uploaderID uint) (int, error) {
+	var count int64
+	err := r.DB.Model(&model.Attachment{}).
+		Where("id IN ? AND room_id = ? AND uploader_id = ? AND message_id IS NULL", ids, roomID, uploaderID).
+		Count(&count).Error
+	return int(count), err
+}
+
+// 添付ファイルをメッセージに紐付け（メッセージの保存と同じトランザクションで呼ぶ）
+// 全件を紐付けられなければ ErrAttachmentUnavailable（トランザクションごと取り消す）
+func linkAttachments(tx *gorm.DB, ids []uuid.UUID, messageID uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	result := tx.Model(&model.Attachment{}).
+		Where("id IN ? AND message_id IS NULL", ids).
+		Update("message_id", messageID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(ids)) {
+		return ErrAttachmentUnavailable
+	}
+	return nil
+}
+
+// メッセージの添付ファイルを削除し、削除したものを返す（保存先のファイルは呼び出し側で消す）
+func deleteMessageAttachments(tx *gorm.DB, messageID uint) ([]model.Attachment, error) {
+	var attachments []model.Attachment
+	if err := tx.Where("message_id = ?", messageID).Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+	if err := tx.Where("message_id = ?", messageID).Delete(&model.Attachment{}).Error; err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
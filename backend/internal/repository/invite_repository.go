@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"chat-app/internal/dto"
+	"chat-app/internal/model"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 招待が使えなくなっていた（取り消し・期限切れ・回数超過）
+var ErrInviteUnavailable = errors.New("invite is no longer usable")
+
+// 既にメンバーだった（同時に参加を押した場合など）
+var ErrAlreadyMember = errors.New("user is already a member of room")
+
+type InviteRepository struct {
+	DB *gorm.DB
+}
+
+func NewInviteRepository(db *gorm.DB) *InviteRepository {
+	return &InviteRepository{DB: db}
+}
+
+func (r *InviteRepository) Create(invite *model.RoomInvite) error {
+	return r.DB.Create(invite).Error
+}
+
+// トークンから招待取得（存在しなければ nil）
+func (r *InviteRepository) FindByToken(token string) (*model.RoomInvite, error) {
+	var invite model.RoomInvite
+	err := r.DB.First(&invite, "token = ?", token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// IDから招待取得（存在しなければ nil）
+func (r *InviteRepository) FindByID(id uint) (*model.RoomInvite, error) {
+	var invite model.RoomInvite
+	err := r.DB.First(&invite, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// ルームの招待一覧（新しい順）
+func (r *InviteRepository) ListByRoom(roomID string) ([]model.RoomInvite, error) {
+	invites := []model.RoomInvite{}
+	err := r.DB.Where("room_id = ?", roomID).Order("created_at DESC").Find(&invites).Error
+	return invites, err
+}
+
+// 招待を取り消す
+func (r *InviteRepository) Revoke(id uint, at time.Time) error {
+	return r.DB.Model(&model.RoomInvite{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error
+}
+
+// 招待で参加（使用回数を数え、メンバー登録・参加の記録・システムメッセージの保存をまとめて行う）
+// 途中で使えなくなっていたら ErrInviteUnavailable、既にメンバーになっていたら ErrAlreadyMember（どちらも何も残さない）
+func (r *InviteRepository) Accept(invite *model.RoomInvite, userID uint, systemMsg *model.Message, at time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// 同時に参加されても上限を超えないよう、条件付きで数える
+		result := tx.Exec(`
+			UPDATE room_invites SET use_count = use_count + 1
+			WHERE id = ? AND revoked_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > ?)
+			  AND (max_uses IS NULL OR use_count < max_uses)
+		`, invite.ID, at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInviteUnavailable
+		}
+
+		member := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.RoomMember{
+			RoomID:   invite.RoomID,
+			UserID:   userID,
+			Role:     model.RoomRoleMember,
+			JoinedAt: at,
+		})
+		if member.Error != nil {
+			return member.Error
+		}
+		if member.RowsAffected == 0 {
+			return ErrAlreadyMember
+		}
+		if err := tx.Create(&model.RoomInviteUse{InviteID: invite.ID, UserID: userID, JoinedAt: at}).Error; err != nil {
+			return err
+		}
+		return saveSystemMessage(tx, systemMsg)
+	})
+}
+
+// 招待から参加したユーザー（新しい順）
+func (r *InviteRepository) ListUses(inviteID uint) ([]dto.InviteUse, error) {
+	uses := []dto.InviteUse{}
+	err := r.DB.Raw(`
+		SELECT iu.invite_id, iu.user_id, u.name, iu.joined_at
+		FROM room_invite_uses iu
+		JOIN members u ON u.id = iu.user_id
+		WHERE iu.invite_id = ?
+		ORDER BY iu.joined_at DESC
+	`, inviteID).Scan(&uses).Error
+	return uses, err
+}
@@ -1,12 +1,22 @@
 package repository
 
 import (
+	"chat-app/internal/dto"
 	"chat-app/internal/model"
+	"chat-app/internal/util"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// 返信数と最終返信日時を含むSELECT句
+const selectWithThreadStats = `messages.*,
+	(SELECT COUNT(*) FROM messages rp WHERE rp.parent_id = messages.id AND rp.deleted_at IS NULL) AS reply_count,
+	(SELECT MAX(rp.created_at) FROM messages rp WHERE rp.parent_id = messages.id AND rp.deleted_at IS NULL) AS last_reply_at`
 
 type MessageRepository struct {
 	DB *gorm.DB
@@ -16,14 +26,56 @@ func NewMessageRepository(db *gorm.DB) *MessageRepository {
 	return &MessageRepository{DB: db}
 }
 
-func (r *MessageRepository) SaveMessage(message *model.Message) error {
-	if err := r.DB.Create(message).Error; err != nil {
-		return err
+// 同じ client_id のメッセージが既にあれば保存せず false を返す
+// 添付ファイルの紐付けとメンションの保存も同じトランザクションで行う（途中で失敗すれば何も残らない）
+func (r *MessageRepository) SaveMessage(message *model.Message, attachmentIDs []uuid.UUID, mentions []model.MessageMention) (bool, error) {
+	saved := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:     []clause.Column{{Name: "room_id"}, {Name: "sender_id"}, {Name: "client_id"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "client_id IS NOT NULL"}}},
+			DoNothing:   true,
+		}).Create(message)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&model.Room{}).
+			Where("id = ?", message.RoomID).
+			Update("last_message", message.Content).Error; err != nil {
+			return err
+		}
+		if err := linkAttachments(tx, attachmentIDs, message.ID); err != nil {
+			return err
+		}
+		if err := replaceMentions(tx, message.ID, mentions); err != nil {
+			return err
+		}
+		saved = true
+		return nil
+	})
+	if err != nil {
+		return false, err
 	}
+	return saved, nil
+}
 
-	return r.DB.Model(&model.Room{}).
-        Where("id = ?", message.RoomID).
-        Update("last_message", message.Content).Error
+// client_id からメッセージ取得（なければ nil）
+func (r *MessageRepository) FindMessageByClientID(roomID uuid.UUID, senderID uint, clientID string) (*model.Message, error) {
+	var message model.Message
+	err := r.DB.Select(selectWithThreadStats).
+		Where("room_id = ? AND sender_id = ? AND client_id = ?", roomID, senderID, clientID).
+		First(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
 }
 
 // メッセージ全件取得
@@ -33,18 +85,19 @@ func (r *MessageRepository) GetMessagesByRoom(roomID uuid.UUID) ([]model.Message
     return messages, err
 }
 
-// メッセージの指定件数取得
-// repository/message_repository.go
-func (r *MessageRepository) GetMessagesBefore(roomID uuid.UUID, before string, limit int) ([]model.Message, error) {
+// メッセージの指定件数取得（スレッド返信と自分だけ削除したメッセージは除く）
+func (r *MessageRepository) GetMessagesBefore(roomID uuid.UUID, userID uint, before string, limit int) ([]model.Message, error) {
 	var messages []model.Message
 
 	query := r.DB.
-		Where("room_id = ?", roomID).
-		Order("created_at DESC").
+		Select(selectWithThreadStats).
+		Where("messages.room_id = ? AND messages.parent_id IS NULL", roomID).
+		Where("NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = messages.id AND h.user_id = ?)", userID).
+		Order("messages.created_at DESC").
 		Limit(limit)
 
 	if before != "" {
-		query = query.Where("created_at < ?", before)
+		query = query.Where("messages.created_at < ?", before)
 	}
 
 	err := query.Find(&messages).Error
@@ -52,10 +105,465 @@ func (r *MessageRepository) GetMessagesBefore(roomID uuid.UUID, before string, l
 		return nil, err
 	}
 
-	// フロントが昇順表示なので、昇順に並べ直す
+	reverseMessages(messages)
+	return messages, nil
+}
+
+// スレッド返信の指定件数取得（自分だけ削除したメッセージは除く）
+func (r *MessageRepository) GetThreadRepliesBefore(parentID uint, userID uint, before string, limit int) ([]model.Message, error) {
+	var messages []model.Message
+
+	query := r.DB.
+		Where("parent_id = ?", parentID).
+		Where("NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = messages.id AND h.user_id = ?)", userID).
+		Order("created_at DESC").
+		Limit(limit)
+
+	if before != "" {
+		query = query.Where("created_at < ?", before)
+	}
+
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	reverseMessages(messages)
+	return messages, nil
+}
+
+// フロントが昇順表示なので、昇順に並べ直す
+func reverseMessages(messages []model.Message) {
 	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
 		messages[i], messages[j] = messages[j], messages[i]
 	}
+}
 
-	return messages, nil
+// IDからメッセージ取得（存在しなければ nil）
+func (r *MessageRepository) FindMessageByID(id uint) (*model.Message, error) {
+	var message model.Message
+	err := r.DB.Select(selectWithThreadStats).First(&message, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// メッセージ編集（編集前の内容は履歴に残す）
+func (r *MessageRepository) UpdateMessageContent(message *model.Message, content string) error {
+	now := time.Now()
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		history := model.MessageEdit{
+			MessageID: message.ID,
+			Content:   message.Content,
+			EditedAt:  now,
+		}
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.Message{}).
+			Where("id = ?", message.ID).
+			Updates(map[string]interface{}{
+				"content":   content,
+				"edited_at": now,
+			}).Error; err != nil {
+			return err
+		}
+
+		// 最新メッセージの編集ならルームの last_message も変わる
+		_, err := refreshLastMessage(tx, message.RoomID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	message.Content = content
+	message.EditedAt = &now
+	return nil
+}
+
+// 編集履歴取得（古い順）
+func (r *MessageRepository) GetMessageEdits(messageID uint) ([]model.MessageEdit, error) {
+	var edits []model.MessageEdit
+	err := r.DB.Where("message_id = ?", messageID).Order("edited_at ASC, id ASC").Find(&edits).Error
+	return edits, err
+}
+
+// 全員から削除（本文をトゥームストーンに置き換え、編集履歴も消す）
+// 戻り値は再計算後のルームの last_message
+// 添付ファイルの行も消し（署名付きURLでも取得できなくなる）、消した添付ファイルを返す
+func (r *MessageRepository) DeleteMessageForEveryone(message *model.Message) (string, []model.Attachment, error) {
+	now := time.Now()
+	var lastMessage string
+	var attachments []model.Attachment
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Message{}).
+			Where("id = ?", message.ID).
+			Updates(map[string]interface{}{
+				"content":    model.DeletedMessageContent,
+				"deleted_at": now,
+			}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("message_id = ?", message.ID).Delete(&model.MessageEdit{}).Error; err != nil {
+			return err
+		}
+
+		// 削除済みメッセージはメンション一覧にも出さない
+		if err := tx.Where("message_id = ?", message.ID).Delete(&model.MessageMention{}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if attachments, err = deleteMessageAttachments(tx, message.ID); err != nil {
+			return err
+		}
+		lastMessage, err = refreshLastMessage(tx, message.RoomID)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	message.Content = model.DeletedMessageContent
+	message.DeletedAt = &now
+	message.Mentions = nil
+	message.MentionAll = false
+	message.Attachments = nil
+	return lastMessage, attachments, nil
+}
+
+// 自分だけ削除（非表示）
+func (r *MessageRepository) HideMessageForUser(messageID uint, userID uint) error {
+	hide := model.MessageHide{
+		MessageID: messageID,
+		UserID:    userID,
+		HiddenAt:  time.Now(),
+	}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&hide).Error
+}
+
+// ルームの last_message を削除されていない最新メッセージで再計算
+func refreshLastMessage(tx *gorm.DB, roomID uuid.UUID) (string, error) {
+	var contents []string
+	if err := tx.Model(&model.Message{}).
+		Where("room_id = ? AND deleted_at IS NULL", roomID).
+		Order("created_at DESC, id DESC").
+		Limit(1).
+		Pluck("content", &contents).Error; err != nil {
+		return "", err
+	}
+
+	lastMessage := ""
+	if len(contents) > 0 {
+		lastMessage = contents[0]
+	}
+
+	err := tx.Model(&model.Room{}).
+		Where("id = ?", roomID).
+		Update("last_message", lastMessage).Error
+	return lastMessage, err
+}
+
+// リアクション追加（追加済みなら false）
+func (r *MessageRepository) AddReaction(messageID uint, userID uint, emoji string) (bool, error) {
+	reaction := model.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+		CreatedAt: time.Now(),
+	}
+	result := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+	return result.RowsAffected > 0, result.Error
+}
+
+// リアクション削除（未リアクションなら false）
+func (r *MessageRepository) RemoveReaction(messageID uint, userID uint, emoji string) (bool, error) {
+	result := r.DB.Delete(&model.MessageReaction{}, "message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji)
+	return result.RowsAffected > 0, result.Error
+}
+
+// 絵文字ごとのリアクション数
+func (r *MessageRepository) CountReactions(messageID uint, emoji string) (int, error) {
+	var count int64
+	err := r.DB.Model(&model.MessageReaction{}).
+		Where("message_id = ? AND emoji = ?", messageID, emoji).
+		Count(&count).Error
+	return int(count), err
+}
+
+// メッセージ一覧にリアクション集計を付与
+func (r *MessageRepository) AttachReactions(messages []model.Message, userID uint) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+
+	var rows []struct {
+		MessageID   uint
+		Emoji       string
+		Count       int
+		ReactedByMe bool
+	}
+	err := r.DB.Raw(`
+		SELECT
+			message_id,
+			emoji,
+			COUNT(*) AS count,
+			BOOL_OR(user_id = ?) AS reacted_by_me
+		FROM message_reactions
+		WHERE message_id IN ?
+		GROUP BY message_id, emoji
+		ORDER BY MIN(created_at)
+	`, userID, ids).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	summaries := make(map[uint][]model.ReactionSummary)
+	for _, row := range rows {
+		summaries[row.MessageID] = append(summaries[row.MessageID], model.ReactionSummary{
+			Emoji:       row.Emoji,
+			Count:       row.Count,
+			ReactedByMe: row.ReactedByMe,
+		})
+	}
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].ID]
+	}
+	return nil
+}
+
+// メンションを置き換え保存
+func (r *MessageRepository) ReplaceMentions(messageID uint, mentions []model.MessageMention) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceMentions(tx, messageID, mentions)
+	})
+}
+
+func replaceMentions(tx *gorm.DB, messageID uint, mentions []model.MessageMention) error {
+	if err := tx.Where("message_id = ?", messageID).Delete(&model.MessageMention{}).Error; err != nil {
+		return err
+	}
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	rows := make([]model.MessageMention, 0, len(mentions))
+	for _, m := range mentions {
+		m.MessageID = messageID
+		rows = append(rows, m)
+	}
+	return tx.Create(&rows).Error
+}
+
+// メッセージ一覧にメンションを付与
+func (r *MessageRepository) AttachMentions(messages []model.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+
+	var mentions []model.MessageMention
+	if err := r.DB.Where("message_id IN ?", ids).Order("user_id").Find(&mentions).Error; err != nil {
+		return err
+	}
+
+	byMessage := make(map[uint][]model.MessageMention)
+	for _, m := range mentions {
+		byMessage[m.MessageID] = append(byMessage[m.MessageID], m)
+	}
+	for i := range messages {
+		messages[i].Mentions = nil
+		messages[i].MentionAll = false
+		// @all でのみ対象になったメンバーがいれば全員宛て
+		for _, m := range byMessage[messages[i].ID] {
+			messages[i].Mentions = append(messages[i].Mentions, m.UserID)
+			messages[i].MentionAll = messages[i].MentionAll || m.IsAll
+		}
+	}
+	return nil
+}
+
+// メッセージ一覧に添付ファイルを付与（全員から削除済みのメッセージは除く）
+func (r *MessageRepository) AttachAttachments(messages []model.Message) error {
+	ids := make([]uint, 0, len(messages))
+	for _, m := range messages {
+		if m.DeletedAt == nil {
+			ids = append(ids, m.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var attachments []model.Attachment
+	if err := r.DB.Where("message_id IN ?", ids).Order("created_at").Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	byMessage := make(map[uint][]model.Attachment)
+	for _, a := range attachments {
+		SignAttachmentURLs(&a)
+		byMessage[*a.MessageID] = append(byMessage[*a.MessageID], a)
+	}
+	for i := range messages {
+		messages[i].Attachments = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+// 署名付きダウンロードURLを付与
+func SignAttachmentURLs(a *model.Attachment) {
+	a.URL = util.SignFileURL(a.ID.String(), "original")
+	if a.ThumbnailKey != nil {
+		a.ThumbnailURL = util.SignFileURL(a.ID.String(), "thumbnail")
+	}
+}
+
+// メッセージ一覧にリアクション・メンション・添付ファイルを付与
+func (r *MessageRepository) AttachDetails(messages []model.Message, userID uint) error {
+	if err := r.AttachReactions(messages, userID); err != nil {
+		return err
+	}
+	if err := r.AttachMentions(messages); err != nil {
+		return err
+	}
+	return r.AttachAttachments(messages)
+}
+
+// 部分一致で探す語と除外する語（"-語"）
+// 引用符は外し、OR は扱わない（部分一致ではすべての語を含むものだけがヒットする）
+func searchTerms(query string) (terms []string, excluded []string) {
+	for _, f := range strings.Fields(strings.ReplaceAll(query, `"`, " ")) {
+		switch {
+		case strings.EqualFold(f, "or"):
+		case strings.HasPrefix(f, "-"):
+			if f != "-" {
+				excluded = append(excluded, f[1:])
+			}
+		default:
+			terms = append(terms, f)
+		}
+	}
+	return terms, excluded
+}
+
+// 自分宛てのメンション一覧（所属中のルームのみ・新しい順）
+func (r *MessageRepository) GetMentionsForUser(userID uint, before string, limit int) ([]dto.MentionItem, error) {
+	var items []dto.MentionItem
+
+	query := r.DB.
+		Table("message_mentions mm").
+		Select("m.*, r.display_name AS room_name, r.is_group, mm.is_all AS mention_all").
+		Joins("JOIN messages m ON m.id = mm.message_id").
+		Joins("JOIN rooms r ON r.id = m.room_id").
+		Joins("JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id = mm.user_id").
+		Where("mm.user_id = ? AND m.deleted_at IS NULL", userID).
+		Where("NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = m.id AND h.user_id = ?)", userID).
+		Order("m.created_at DESC").
+		Limit(limit)
+
+	if before != "" {
+		query = query.Where("m.created_at < ?", before)
+	}
+
+	err := query.Scan(&items).Error
+	return items, err
+}
+
+// 全文検索（所属中のルームのみ・新しい順）
+// 続きの有無を判定できるよう limit+1 件まで返す
+// 日本語は単語に分かれないため、各語の部分一致（pg_trgm の索引を使う）でもヒットさせる
+func (r *MessageRepository) SearchMessages(userID uint, params dto.SearchParams) ([]dto.SearchResult, error) {
+	var sb strings.Builder
+	args := []interface{}{params.Query, userID, userID}
+	terms, excluded := searchTerms(params.Query)
+
+	// HTMLとして安全に表示できるようエスケープしてからハイライトする
+	sb.WriteString(`
+		WITH q AS (SELECT websearch_to_tsquery('simple', ?) AS query)
+		SELECT
+			m.id AS message_id,
+			m.room_id,
+			r.display_name AS room_name,
+			r.is_group,
+			m.parent_id,
+			m.sender_id,
+			m.sender,
+			ts_headline(
+				'simple',
+				replace(replace(replace(m.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+				q.query,
+				'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5'
+			) AS snippet,
+			m.created_at
+		FROM messages m
+		CROSS JOIN q
+		JOIN rooms r ON r.id = m.room_id
+		JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id = ?
+		WHERE m.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = m.id AND h.user_id = ?)
+	`)
+
+	if len(terms) == 0 {
+		sb.WriteString(" AND m.search_vector @@ q.query")
+	} else {
+		sb.WriteString(" AND (m.search_vector @@ q.query OR (")
+		for i, term := range terms {
+			if i > 0 {
+				sb.WriteString(" AND ")
+			}
+			sb.WriteString("m.content ILIKE ?")
+			args = append(args, "%"+likeEscaper.Replace(term)+"%")
+		}
+		for _, term := range excluded {
+			sb.WriteString(" AND m.content NOT ILIKE ?")
+			args = append(args, "%"+likeEscaper.Replace(term)+"%")
+		}
+		sb.WriteString("))")
+	}
+
+	if params.RoomID != nil {
+		sb.WriteString(" AND m.room_id = ?")
+		args = append(args, *params.RoomID)
+	}
+	if params.SenderID != nil {
+		sb.WriteString(" AND m.sender_id = ?")
+		args = append(args, *params.SenderID)
+	}
+	if params.From != nil {
+		sb.WriteString(" AND m.created_at >= ?")
+		args = append(args, *params.From)
+	}
+	if params.To != nil {
+		sb.WriteString(" AND m.created_at < ?")
+		args = append(args, *params.To)
+	}
+	if params.Cursor != nil {
+		sb.WriteString(" AND (m.created_at, m.id) < (?, ?)")
+		args = append(args, params.Cursor.CreatedAt, params.Cursor.ID)
+	}
+
+	sb.WriteString(" ORDER BY m.created_at DESC, m.id DESC LIMIT ?")
+	args = append(args, params.Limit+1)
+
+	var results []dto.SearchResult
+	err := r.DB.Raw(sb.String(), args...).Scan(&results).Error
+	return results, err
 }
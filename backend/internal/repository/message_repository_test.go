@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		query        string
+		wantTerms    []string
+		wantExcluded []string
+	}{
+		{"会議", []string{"会議"}, nil},
+		{"明日の 会議", []string{"明日の", "会議"}, nil},
+		{"  会議\t資料  ", []string{"会議", "資料"}, nil},
+		// 引用符は外して語ごとに部分一致させる
+		{`"週次 会議"`, []string{"週次", "会議"}, nil},
+		{`"会議"資料`, []string{"会議", "資料"}, nil},
+		// 除外指定
+		{"会議 -中止", []string{"会議"}, []string{"中止"}},
+		{"-中止 -延期", nil, []string{"中止", "延期"}},
+		{"会議 -", []string{"会議"}, nil},
+		// OR は部分一致では扱わない
+		{"会議 OR 打ち合わせ", []string{"会議", "打ち合わせ"}, nil},
+		{"会議 or 打ち合わせ", []string{"会議", "打ち合わせ"}, nil},
+		// 語の途中の "-" はそのまま
+		{"e-mail", []string{"e-mail"}, nil},
+		// LIKE の特殊文字は呼び出し側でエスケープする
+		{"100%", []string{"100%"}, nil},
+		{"", nil, nil},
+		{`""`, nil, nil},
+	}
+	for _, tt := range tests {
+		terms, excluded := searchTerms(tt.query)
+		if !reflect.DeepEqual(terms, tt.wantTerms) || !reflect.DeepEqual(excluded, tt.wantExcluded) {
+			t.Errorf("searchTerms(%q) = %q, %q; want %q, %q", tt.query, terms, excluded, tt.wantTerms, tt.wantExcluded)
+		}
+	}
+}
@@ -4,14 +4,30 @@ import (
 	"chat-app/internal/dto"
 	"chat-app/internal/model"
 	"errors"
-	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
+// 削除しようとしたユーザーがメンバーでない
+var ErrNotMember = errors.New("user is not a member of room")
+
+// 同じ名前の公開チャンネルがある（idx_rooms_public_name に違反）
+var ErrDuplicateChannelName = errors.New("public channel name already exists")
+
+// 公開チャンネル名の一意制約の違反なら ErrDuplicateChannelName に置き換える
+// （事前の確認と作成・変更の間に同じ名前を使われた場合）
+func translateRoomError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_rooms_public_name" {
+		return ErrDuplicateChannelName
+	}
+	return err
+}
+
 type RoomRepository struct {
     DB *gorm.DB
 }
@@ -54,34 +70,27 @@ func (r *RoomRepository) FindRoomByUsers(userAID, userBID uint) (*model.Room, er
     return &room, nil
 }
 
-// ルームIDからルーム情報取得
-func (r *RoomRepository) FindGroupRoomByName(name string) (*model.Room, error) {
-    var room model.Room
-    err := r.DB.
-        Where("is_group = ? AND name = ?", true, name).
-        First(&room).Error
-
-    if errors.Is(err, gorm.ErrRecordNotFound) {
-        return nil, nil
-    }
-    return &room, err
-}
-
-// ルーム作成
-func (r *RoomRepository) CreateRoom(room *model.Room, userIDs []uint) error {
+// ルーム作成（ownerID のメンバーを owner にする。0 なら全員 member）
+func (r *RoomRepository) CreateRoom(room *model.Room, userIDs []uint, ownerID uint) error {
     // トランザクションでまとめて処理
     return r.DB.Transaction(func(tx *gorm.DB) error {
         // rooms テーブルに挿入
         if err := tx.Create(room).Error; err != nil {
-            return err
+            return translateRoomError(err)
         }
 
         // room_members に全メンバー登録
         var members []model.RoomMember
         for _, uid := range userIDs {
+            role := model.RoomRoleMember
+            if uid == ownerID {
+                role = model.RoomRoleOwner
+            }
             members = append(members, model.RoomMember{
-                RoomID: room.ID,
-                UserID: uid,
+                RoomID:   room.ID,
+                UserID:   uid,
+                Role:     role,
+                JoinedAt: room.CreatedAt,
             })
         }
 
@@ -122,56 +131,152 @@ func (r *RoomRepository) GetRoomsWithUnreadCount(userID uint) ([]dto.RoomWithUnr
         r.id AS room_id,
         r.display_name,
         r.is_group,
+        rm.role,
+        rm.notify_level,
+        rm.muted_until,
+        r.visibility,
+        r.topic,
         r.last_message,
         MAX(m.created_at) AS last_message_at,
+        rr.last_read_message_id,
         COUNT(CASE
-            WHEN m.created_at > COALESCE(rr.last_read_at, '1970-01-01')
-                AND m.sender_id != ? THEN 1
+            WHEN m.id > COALESCE(rr.last_read_message_id, 0)
+                AND m.sender_id != ?
+                AND m.deleted_at IS NULL THEN 1
             ELSE NULL
-        END) AS unread_count
+        END) AS unread_count,
+        COUNT(CASE
+            WHEN m.id > COALESCE(rr.last_read_message_id, 0)
+                AND m.sender_id != ?
+                AND m.deleted_at IS NULL
+                AND EXISTS (
+                    SELECT 1 FROM message_mentions mm
+                    WHERE mm.message_id = m.id AND mm.user_id = ?
+                ) THEN 1
+            ELSE NULL
+        END) AS mention_count
         FROM rooms r
         JOIN room_members rm ON r.id = rm.room_id
         LEFT JOIN messages m ON m.room_id = r.id
         LEFT JOIN room_reads rr ON rr.room_id = r.id AND rr.user_id = ?
         WHERE rm.user_id = ?
-        GROUP BY r.id, r.display_name, rr.last_read_at
+        GROUP BY r.id, r.display_name, rm.role, rm.notify_level, rm.muted_until, rr.last_read_message_id
     `
 
-    if err := r.DB.Raw(query, userID, userID, userID).Scan(&result).Error; err != nil {
+    if err := r.DB.Raw(query, userID, userID, userID, userID, userID).Scan(&result).Error; err != nil {
         return nil, err
     }
 
     return result, nil
 }
 
-// 既読管理
-func (r *RoomRepository) UpsertRoomRead(userID uint, roomID string) error {
-    read := model.RoomRead{
-        UserID:     userID,
-        RoomID:     roomID,
-        LastReadAt: time.Now(),
+// 既読位置を進める（今より前のメッセージを指定しても戻らない）
+// 戻り値は更新後の既読位置と、実際に進んだかどうか
+func (r *RoomRepository) AdvanceRoomRead(userID uint, roomID string, messageID uint, readAt time.Time) (uint, bool, error) {
+    var row struct {
+        LastReadMessageID uint
+        PrevID            *uint
+    }
+    err := r.DB.Raw(`
+        WITH prev AS (
+            SELECT last_read_message_id FROM room_reads WHERE user_id = ? AND room_id = ?
+        )
+        INSERT INTO room_reads (user_id, room_id, last_read_at, last_read_message_id)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (user_id, room_id) DO UPDATE SET
+            last_read_at = CASE
+                WHEN EXCLUDED.last_read_message_id > COALESCE(room_reads.last_read_message_id, 0)
+                THEN EXCLUDED.last_read_at ELSE room_reads.last_read_at END,
+            last_read_message_id = GREATEST(COALESCE(room_reads.last_read_message_id, 0), EXCLUDED.last_read_message_id)
+        RETURNING last_read_message_id, (SELECT last_read_message_id FROM prev) AS prev_id
+    `, userID, roomID, userID, roomID, readAt, messageID).Scan(&row).Error
+    if err != nil {
+        return 0, false, err
     }
 
-    return r.DB.
-        Clauses(clause.OnConflict{
-            Columns:   []clause.Column{{Name: "user_id"}, {Name: "room_id"}},
-            DoUpdates: clause.AssignmentColumns([]string{"last_read_at"}),
-        }).
-        Create(&read).Error
+    advanced := row.PrevID == nil || row.LastReadMessageID > *row.PrevID
+    return row.LastReadMessageID, advanced, nil
+}
+
+// ルームの最新メッセージID（メッセージがなければ 0）
+func (r *RoomRepository) LatestMessageID(roomID string) (uint, error) {
+    var id uint
+    err := r.DB.Raw(`SELECT COALESCE(MAX(id), 0) FROM messages WHERE room_id = ?`, roomID).Scan(&id).Error
+    return id, err
+}
+
+// メッセージがルームのものか
+func (r *RoomRepository) MessageInRoom(messageID uint, roomID string) (bool, error) {
+    var count int64
+    err := r.DB.Model(&model.Message{}).Where("id = ? AND room_id = ?", messageID, roomID).Count(&count).Error
+    return count > 0, err
+}
+
+// ルーム取得（なければ nil）
+func (r *RoomRepository) FindRoomByID(roomID string) (*model.Room, error) {
+    var room model.Room
+    err := r.DB.Where("id = ?", roomID).Limit(1).Find(&room).Error
+    if err != nil || room.ID == uuid.Nil {
+        return nil, err
+    }
+    return &room, nil
+}
+
+// 1対1ルームで、相手から届いた messageID までのメッセージを配信済みにする
+// 新たに配信済みになったメッセージがあれば true
+func (r *RoomRepository) MarkMessagesDelivered(roomID string, recipientID uint, messageID uint, at time.Time) (bool, error) {
+    result := r.DB.Exec(`
+        UPDATE messages m SET delivered_at = ?
+        FROM rooms r
+        WHERE r.id = m.room_id AND r.is_group = false
+          AND m.room_id = ? AND m.sender_id <> ? AND m.id <= ?
+          AND m.delivered_at IS NULL
+    `, at, roomID, recipientID, messageID)
+    return result.RowsAffected > 0, result.Error
+}
+
+// 1対1ルームで、相手から届いた messageID までのメッセージを既読にする（未配信のものは配信済みにもする）
+// 新たに既読になったメッセージがあれば true
+func (r *RoomRepository) MarkMessagesRead(roomID string, readerID uint, messageID uint, at time.Time) (bool, error) {
+    result := r.DB.Exec(`
+        UPDATE messages m SET read_at = ?, delivered_at = COALESCE(m.delivered_at, ?)
+        FROM rooms r
+        WHERE r.id = m.room_id AND r.is_group = false
+          AND m.room_id = ? AND m.sender_id <> ? AND m.id <= ?
+          AND m.read_at IS NULL
+    `, at, at, roomID, readerID, messageID)
+    return result.RowsAffected > 0, result.Error
+}
+
+// メッセージを既読にしたメンバー（送信者と、既読を知らせない設定のユーザーは除く）
+func (r *RoomRepository) GetSeenBy(roomID uuid.UUID, messageID uint, senderID uint) ([]dto.SeenBy, error) {
+    seenBy := []dto.SeenBy{}
+    err := r.DB.Raw(`
+        SELECT u.id AS user_id, u.name, rr.last_read_at
+        FROM room_reads rr
+        JOIN room_members rm ON rm.room_id = rr.room_id AND rm.user_id = rr.user_id
+        JOIN members u ON u.id = rr.user_id
+        LEFT JOIN user_settings us ON us.user_id = rr.user_id
+        WHERE rr.room_id = ? AND rr.last_read_message_id >= ? AND rr.user_id <> ?
+          AND COALESCE(us.read_receipts_enabled, TRUE)
+        ORDER BY u.name ASC, u.id ASC
+    `, roomID, messageID, senderID).Scan(&seenBy).Error
+    return seenBy, err
 }
 
 // グループ名変更
 func (r *RoomRepository) UpdateDisplayName(roomID string, name string) error {
-    return r.DB.Model(&model.Room{}).
+    err := r.DB.Model(&model.Room{}).
         Where("id = ? AND is_group = true", roomID).
         Update("display_name", name).Error
+    return translateRoomError(err)
 }
 
 // ルームメンバー取得
 func (r *RoomRepository) GetRoomMembers(roomID string) ([]dto.UserSummary, error) {
 	var users []dto.UserSummary
 	err := r.DB.Raw(`
-		SELECT u.id, u.name
+		SELECT u.id, u.name, rm.role
 		FROM members u
 		JOIN room_members rm ON rm.user_id = u.id
 		WHERE rm.room_id = ?
@@ -181,12 +286,47 @@ func (r *RoomRepository) GetRoomMembers(roomID string) ([]dto.UserSummary, error
 	return users, err
 }
 
-// ルーム退会
-func (r *RoomRepository) RemoveMember(roomID string, userID uint) error {
+// 同じルームに所属している他のユーザーのID
+func (r *RoomRepository) GetCoMemberIDs(userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Raw(`
+		SELECT DISTINCT rm2.user_id
+		FROM room_members rm1
+		JOIN room_members rm2 ON rm2.room_id = rm1.room_id
+		WHERE rm1.user_id = ? AND rm2.user_id <> ?
+	`, userID, userID).Scan(&ids).Error
+	return ids, err
+}
+
+// グループにメンバーを追加し、記録用のシステムメッセージを保存
+// 既にメンバーのユーザーは飛ばす
+func (r *RoomRepository) AddMembers(roomID string, userIDs []uint, systemMsg *model.Message) error {
 	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for _, uid := range userIDs {
+			if err := tx.Exec(`
+				INSERT INTO room_members (room_id, user_id) VALUES (?, ?)
+				ON CONFLICT DO NOTHING
+			`, roomID, uid).Error; err != nil {
+				return err
+			}
+		}
+		return saveSystemMessage(tx, systemMsg)
+	})
+}
+
+// ルーム退会・メンバー削除（systemMsg があればあわせて保存）
+// owner が抜けたグループでは残ったメンバーを owner に昇格させ、そのユーザーIDを返す（昇格がなければ 0）
+// メンバーでなければ（同時に抜けた場合も含む）ErrNotMember
+func (r *RoomRepository) RemoveMember(roomID string, userID uint, systemMsg *model.Message) (uint, error) {
+	var promotedID uint
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
 		// 1. 削除
-		if err := tx.Delete(&model.RoomMember{}, "room_id = ? AND user_id = ?", roomID, userID).Error; err != nil {
-			return err
+		res := tx.Delete(&model.RoomMember{}, "room_id = ? AND user_id = ?", roomID, userID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotMember
 		}
 
 		// 2. 残りの人数チェック
@@ -195,25 +335,166 @@ func (r *RoomRepository) RemoveMember(roomID string, userID uint) error {
 			return err
 		}
 
-		// 3. ルーム削除 or name 更新
+		// 3. ルーム削除 or システムメッセージ保存
 		if count == 0 {
 			// 誰もいないなら部屋も削除
 			if err := tx.Delete(&model.Room{}, "id = ?", roomID).Error; err != nil {
 				return err
 			}
 		} else {
-			// name の "_<userID>" を削除
-			if err := tx.Exec(`
-				UPDATE rooms
-				SET name = REPLACE(name, ?, '')
-				WHERE id = ? AND is_group = true
-			`, fmt.Sprintf("_%d", userID), roomID).Error; err != nil {
+			if err := saveSystemMessage(tx, systemMsg); err != nil {
+				return err
+			}
+			// owner がいなくなったら、admin → member の順に参加が早いメンバーを昇格
+			if err := tx.Raw(`
+				UPDATE room_members SET role = 'owner'
+				WHERE room_id = ? AND user_id = (
+					SELECT rm.user_id FROM room_members rm
+					JOIN rooms r ON r.id = rm.room_id AND r.is_group = true
+					WHERE rm.room_id = ?
+					  AND NOT EXISTS (SELECT 1 FROM room_members o WHERE o.room_id = rm.room_id AND o.role = 'owner')
+					ORDER BY rm.role = 'admin' DESC, rm.joined_at ASC, rm.user_id ASC
+					LIMIT 1
+				)
+				RETURNING user_id
+			`, roomID, roomID).Scan(&promotedID).Error; err != nil {
 				return err
 			}
 		}
 
 		return nil
 	})
+	return promotedID, err
+}
+
+// ルームでのメンバー情報（メンバーでなければ nil）
+func (r *RoomRepository) FindMembership(roomID string, userID uint) (*model.RoomMember, error) {
+	var member model.RoomMember
+	err := r.DB.Where("room_id = ? AND user_id = ?", roomID, userID).Limit(1).Find(&member).Error
+	if err != nil || member.UserID == 0 {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// 通知設定を更新
+func (r *RoomRepository) SetNotifySettings(roomID string, userID uint, level string, mutedUntil *time.Time) error {
+	return r.DB.Model(&model.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Updates(map[string]interface{}{"notify_level": level, "muted_until": mutedUntil}).Error
+}
+
+// 通知設定が all 以外のメンバー
+func (r *RoomRepository) GetNotifySettings(roomID string) ([]model.RoomMember, error) {
+	var members []model.RoomMember
+	err := r.DB.Select("user_id, notify_level, muted_until").
+		Where("room_id = ? AND notify_level <> ?", roomID, model.NotifyLevelAll).
+		Find(&members).Error
+	return members, err
+}
+
+// メンバーの役割を変更（owner の付け替えは TransferOwnership で行う）
+func (r *RoomRepository) SetMemberRole(roomID string, userID uint, role string) error {
+	return r.DB.Model(&model.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("role", role).Error
+}
+
+// owner を移す（元の owner は admin になる）
+func (r *RoomRepository) TransferOwnership(roomID string, fromID uint, toID uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// owner は1人だけなので先に降格する
+		if err := tx.Model(&model.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, fromID).
+			Update("role", model.RoomRoleAdmin).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, toID).
+			Update("role", model.RoomRoleOwner).Error
+	})
+}
+
+// メッセージをピン留め（ピン留め済みなら false）
+func (r *RoomRepository) PinMessage(roomID string, messageID uint, userID uint, at time.Time) (bool, error) {
+	result := r.DB.Exec(`
+		INSERT INTO room_pins (room_id, message_id, pinned_by, pinned_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`, roomID, messageID, userID, at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ピン留めを外す（ピン留めされていなければ false）
+func (r *RoomRepository) UnpinMessage(roomID string, messageID uint) (bool, error) {
+	result := r.DB.Exec(`DELETE FROM room_pins WHERE room_id = ? AND message_id = ?`, roomID, messageID)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ピン留めしたメッセージ（新しくピン留めした順・削除済みは除く）
+func (r *RoomRepository) GetPinnedMessages(roomID string) ([]dto.PinnedMessage, error) {
+	pins := []dto.PinnedMessage{}
+	err := r.DB.Raw(`
+		SELECT m.id AS message_id, m.sender_id, m.sender, m.content, m.created_at, p.pinned_by, p.pinned_at
+		FROM room_pins p
+		JOIN messages m ON m.id = p.message_id
+		WHERE p.room_id = ? AND m.deleted_at IS NULL
+		ORDER BY p.pinned_at DESC
+	`, roomID).Scan(&pins).Error
+	return pins, err
+}
+
+// 同じ名前の公開チャンネルがあるか（大文字小文字は区別しない）
+func (r *RoomRepository) PublicChannelNameExists(name string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&model.Room{}).
+		Where("visibility = ? AND lower(display_name) = lower(?)", model.RoomVisibilityPublic, name).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// 公開チャンネルの一覧（メンバーの多い順）
+// query があれば名前・トピック・説明の部分一致で絞り込む
+func (r *RoomRepository) ListPublicChannels(userID uint, query string, limit int, offset int) ([]dto.ChannelSummary, error) {
+	channels := []dto.ChannelSummary{}
+	db := r.DB.
+		Table("rooms r").
+		Select(`r.id AS room_id, r.display_name, r.topic, r.description, r.created_at,
+			(SELECT COUNT(*) FROM room_members rm WHERE rm.room_id = r.id) AS member_count,
+			EXISTS (SELECT 1 FROM room_members rm WHERE rm.room_id = r.id AND rm.user_id = ?) AS is_member`, userID).
+		Where("r.visibility = ?", model.RoomVisibilityPublic)
+
+	if query != "" {
+		pattern := "%" + likeEscaper.Replace(query) + "%"
+		db = db.Where("(r.display_name ILIKE ? OR r.topic ILIKE ? OR r.description ILIKE ?)", pattern, pattern, pattern)
+	}
+
+	err := db.Order("member_count DESC, r.display_name ASC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&channels).Error
+	return channels, err
+}
+
+// LIKE のワイルドカードをそのままの文字として扱う
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// チャンネルのトピックと説明を変更
+func (r *RoomRepository) UpdateChannelInfo(roomID string, topic string, description string) error {
+	return r.DB.Model(&model.Room{}).
+		Where("id = ?", roomID).
+		Updates(map[string]interface{}{"topic": topic, "description": description}).Error
+}
+
+func saveSystemMessage(tx *gorm.DB, msg *model.Message) error {
+	if msg == nil {
+		return nil
+	}
+	if err := tx.Create(msg).Error; err != nil {
+		return err
+	}
+	return tx.Model(&model.Room{}).
+		Where("id = ?", msg.RoomID).
+		Update("last_message", msg.Content).Error
 }
 
 // グループ削除
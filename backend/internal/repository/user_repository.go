@@ -2,6 +2,7 @@ package repository
 
 import (
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"chat-app/internal/model"
 )
 
@@ -45,3 +46,18 @@ func (r *UserRepository) GetUsersByIDs(ids []uint) ([]model.User, error) {
     }
     return users, nil
 }
+
+// ユーザー設定取得（未設定なら既定値）
+func (r *UserRepository) GetSettings(userID uint) (*model.UserSetting, error) {
+	settings := model.UserSetting{UserID: userID, ReadReceiptsEnabled: true}
+	err := r.DB.Where("user_id = ?", userID).Limit(1).Find(&settings).Error
+	return &settings, err
+}
+
+// ユーザー設定保存
+func (r *UserRepository) SaveSettings(settings *model.UserSetting) error {
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"read_receipts_enabled", "updated_at"}),
+	}).Create(settings).Error
+}
@@ -2,7 +2,9 @@ package router
 
 import (
 	"chat-app/internal/handler"
+	"chat-app/internal/hub"
 	"chat-app/internal/middleware"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,6 +16,9 @@ func SetupRouter(
 	msgHandler *handler.MessageHandler,
 	wsHandler *handler.WebSocketHandler,
 	wsNotifyHandler *handler.NotifyWSHandler,
+	attachmentHandler *handler.AttachmentHandler,
+	inviteHandler *handler.InviteHandler,
+	channelHandler *handler.ChannelHandler,
 ) *gin.Engine {
 	r := gin.Default()
 
@@ -39,8 +44,35 @@ func SetupRouter(
 
 		auth.GET("/users", userHandler.ListUsers)
 		auth.GET("/me", userHandler.Me)
+		// 通知WebSocketに接続中の端末一覧
+		auth.GET("/me/sessions", wsNotifyHandler.ListSessions)
+		auth.GET("/me/settings", userHandler.GetSettings)
+		auth.PUT("/me/settings", userHandler.UpdateSettings)
+		// 通知のロングポーリング（WebSocket を使えない場合）
+		auth.GET("/notify/poll", wsNotifyHandler.Poll)
+		auth.POST("/notify/ack", wsNotifyHandler.Ack)
 
 		auth.GET("/messages/:room_id", msgHandler.GetMessages)
+		auth.GET("/mentions", msgHandler.ListMentions)
+		auth.GET("/search", msgHandler.Search)
+		auth.GET("/messages/:room_id/threads/:id", msgHandler.GetThread)
+		// メッセージ編集
+		auth.PUT("/messages/:id", msgHandler.EditMessage)
+		auth.GET("/messages/:room_id/edits/:id", msgHandler.GetEditHistory)
+		auth.GET("/messages/:room_id/seen/:id", msgHandler.GetSeenBy)
+		// メッセージ削除（全員から / 自分だけ）
+		auth.DELETE("/messages/:id", msgHandler.DeleteMessage)
+		auth.DELETE("/messages/:id/me", msgHandler.HideMessage)
+		// リアクション
+		auth.POST("/messages/:id/reactions", msgHandler.AddReaction)
+		auth.DELETE("/messages/:id/reactions/:emoji", msgHandler.RemoveReaction)
+
+		// メッセージ送信（WebSocket を使えない場合）
+		auth.POST("/rooms/:room_id/messages", msgHandler.SendMessage)
+
+		// 添付ファイル
+		auth.POST("/rooms/:room_id/attachments", attachmentHandler.Upload)
+		auth.GET("/attachments/:id", attachmentHandler.Get)
 
 		auth.POST("/rooms", roomHandler.CreateRoom)
 		auth.GET("/rooms", roomHandler.ListRooms)
@@ -49,8 +81,29 @@ func SetupRouter(
 
 		// 既読管理
 		auth.POST("/rooms/:room_id/read", roomHandler.MarkRoomAsRead)
+		// 通知設定（ミュート・メンションのみ）
+		auth.GET("/rooms/:id/settings", roomHandler.GetRoomSettings)
+		auth.PUT("/rooms/:room_id/settings", roomHandler.UpdateRoomSettings)
 		// グループ退会
 		auth.DELETE("/rooms/:room_id/members/me", roomHandler.LeaveRoom)
+		auth.POST("/rooms/:room_id/members", roomHandler.AddMembers)
+		auth.DELETE("/rooms/:room_id/members/:user_id", roomHandler.RemoveMember)
+		auth.PUT("/rooms/:room_id/members/:user_id/role", roomHandler.ChangeMemberRole)
+		auth.POST("/rooms/:room_id/owner", roomHandler.TransferOwnership)
+		auth.GET("/rooms/:id/pins", roomHandler.GetPinnedMessages)
+		auth.POST("/rooms/:room_id/pins", roomHandler.PinMessage)
+		auth.DELETE("/rooms/:room_id/pins/:message_id", roomHandler.UnpinMessage)
+		auth.POST("/rooms/:room_id/invites", inviteHandler.CreateInvite)
+		auth.GET("/rooms/:id/invites", inviteHandler.ListInvites)
+		auth.DELETE("/rooms/:room_id/invites/:invite_id", inviteHandler.RevokeInvite)
+		auth.GET("/rooms/:id/invites/:invite_id/uses", inviteHandler.ListInviteUses)
+		auth.GET("/invites/:token", inviteHandler.Preview)
+		auth.POST("/invites/:token/accept", inviteHandler.Accept)
+		auth.GET("/channels", channelHandler.ListChannels)
+		auth.POST("/channels", channelHandler.CreateChannel)
+		auth.POST("/channels/:room_id/join", channelHandler.JoinChannel)
+		auth.POST("/channels/:room_id/leave", channelHandler.LeaveChannel)
+		auth.PUT("/channels/:room_id", channelHandler.UpdateChannelInfo)
 		// グループ削除
 		auth.DELETE("/rooms/:room_id", roomHandler.DeleteRoom)
 	}
@@ -60,6 +113,9 @@ func SetupRouter(
 	r.POST("/login", authHandler.Login)
 	r.POST("/logout", authHandler.Logout)
 
+	// 署名付きURLで認可済みのダウンロード
+	r.GET("/files/:id", attachmentHandler.Download)
+
 	r.GET("/login-page", func(c *gin.Context) {
 		c.HTML(200, "login.html", nil)
 	})
@@ -69,6 +125,20 @@ func SetupRouter(
 
 	r.GET("/ws", wsHandler.Handle)
 	r.GET("/ws-notify", wsNotifyHandler.Handle)
+	// 全ルームと通知を1本で扱う多重化接続
+	r.GET("/ws-mux", wsHandler.HandleMux)
+	// 通知の Server-Sent Events（WebSocket を使えない場合）
+	r.GET("/notify/stream", wsNotifyHandler.Stream)
 
 	return r
 }
+
+// 内部向けのメトリクス（WebSocket の接続数・切断理由など。cmdline や memstats は出さない）
+// サーバー全体の値なので利用者向けのポートには載せず、METRICS_ADDR で別に待ち受ける
+func SetupMetricsRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/debug/vars", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(hub.MetricsJSON()))
+	})
+	return r
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"bytes"
+	"chat-app/internal/model"
+	"chat-app/internal/repository"
+	"chat-app/internal/storage"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrFileTooLarge       = errors.New("file is too large")
+	ErrFileTypeNotAllowed = errors.New("file type is not allowed")
+)
+
+// 既定のアップロード上限（ATTACHMENT_MAX_BYTES で変更可）
+const defaultMaxUploadBytes = 10 << 20
+
+// アップロードを許可するファイル形式（中身から判定した MIME タイプ）
+var allowedContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"application/zip": true,
+	"text/plain":      true,
+}
+
+type AttachmentService struct {
+	aRepo   *repository.AttachmentRepository
+	rRepo   *repository.RoomRepository
+	storage storage.Storage
+}
+
+func NewAttachmentService(attachmentRepo *repository.AttachmentRepository, roomRepo *repository.RoomRepository, store storage.Storage) *AttachmentService {
+	return &AttachmentService{
+		aRepo:   attachmentRepo,
+		rRepo:   roomRepo,
+		storage: store,
+	}
+}
+
+// アップロード上限（バイト）
+func MaxUploadBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultMaxUploadBytes
+}
+
+// ファイルを保存し、送信前の添付ファイルとして登録（ルームメンバーのみ）
+func (s *AttachmentService) Upload(ctx context.Context, userID uint, roomID uuid.UUID, fh *multipart.FileHeader) (*model.Attachment, error) {
+	ok, err := s.rRepo.InUserInRoom(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRoomAccessDenied
+	}
+
+	if fh.Size > MaxUploadBytes() {
+		return nil, ErrFileTooLarge
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// 拡張子やクライアント申告ではなく中身から形式を判定
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if !allowedContentTypes[contentType] {
+		return nil, ErrFileTypeNotAllowed
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	id := uuid.New()
+	fileName := sanitizeFileName(fh.Filename)
+	attachment := &model.Attachment{
+		ID:          id,
+		RoomID:      roomID,
+		UploaderID:  userID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        fh.Size,
+		StorageKey:  path.Join("attachments", roomID.String(), id.String(), "original"),
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.storage.Put(ctx, attachment.StorageKey, f, fh.Size, contentType); err != nil {
+		return nil, err
+	}
+
+	if thumbnailFormats[contentType] {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		s.storeThumbnail(ctx, attachment, f)
+	}
+
+	if err := s.aRepo.Create(attachment); err != nil {
+		s.storage.Delete(ctx, attachment.StorageKey)
+		if attachment.ThumbnailKey != nil {
+			s.storage.Delete(ctx, *attachment.ThumbnailKey)
+		}
+		return nil, err
+	}
+
+	repository.SignAttachmentURLs(attachment)
+	return attachment, nil
+}
+
+// サムネイル生成（失敗しても添付自体は有効）
+func (s *AttachmentService) storeThumbnail(ctx context.Context, attachment *model.Attachment, r io.ReadSeeker) {
+	thumb, thumbType, width, height, err := generateThumbnail(r, attachment.ContentType)
+	if err != nil {
+		log.Println("サムネイル生成失敗:", err)
+		return
+	}
+	if width > 0 && height > 0 {
+		attachment.Width = &width
+		attachment.Height = &height
+	}
+	if thumb == nil {
+		return
+	}
+
+	key := path.Join("attachments", attachment.RoomID.String(), attachment.ID.String(), "thumbnail")
+	if err := s.storage.Put(ctx, key, bytes.NewReader(thumb), int64(len(thumb)), thumbType); err != nil {
+		log.Println("サムネイル保存失敗:", err)
+		return
+	}
+	attachment.ThumbnailKey = &key
+}
+
+// 添付ファイル情報と署名付きURLを取得（ルームメンバーのみ）
+func (s *AttachmentService) GetForUser(userID uint, id uuid.UUID) (*model.Attachment, error) {
+	attachment, err := s.aRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if attachment == nil {
+		return nil, ErrAttachmentNotFound
+	}
+
+	ok, err := s.rRepo.InUserInRoom(userID, attachment.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRoomAccessDenied
+	}
+
+	// 送信前の添付ファイルはアップロードした本人のみ
+	if attachment.MessageID == nil && attachment.UploaderID != userID {
+		return nil, ErrAttachmentNotFound
+	}
+
+	repository.SignAttachmentURLs(attachment)
+	return attachment, nil
+}
+
+// 署名検証済みのダウンロード用にファイルを開く
+// 戻り値の Content-Type はサムネイルの場合サムネイルの形式
+func (s *AttachmentService) Open(ctx context.Context, id uuid.UUID, variant string) (io.ReadCloser, *model.Attachment, string, error) {
+	attachment, err := s.aRepo.FindByID(id)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if attachment == nil {
+		return nil, nil, "", ErrAttachmentNotFound
+	}
+
+	key, contentType := attachment.StorageKey, attachment.ContentType
+	if variant == "thumbnail" {
+		if attachment.ThumbnailKey == nil {
+			return nil, nil, "", ErrAttachmentNotFound
+		}
+		key = *attachment.ThumbnailKey
+		contentType = "image/png"
+		if attachment.ContentType == "image/jpeg" {
+			contentType = "image/jpeg"
+		}
+	}
+
+	rc, err := s.storage.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, "", ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return rc, attachment, contentType, nil
+}
+
+// パス区切りや制御文字を除いたファイル名
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
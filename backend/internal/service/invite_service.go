@@ -0,0 +1,213 @@
+package service
+
+import (
+	"chat-app/internal/dto"
+	"chat-app/internal/model"
+	"chat-app/internal/repository"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInviteNotFound    = errors.New("invite not found")
+	ErrInviteUnavailable = errors.New("invite is expired, revoked or used up")
+	ErrInvalidInvite     = errors.New("invalid invite settings")
+)
+
+// 招待の有効期限と使用回数の上限
+const (
+	maxInviteTTL  = 30 * 24 * time.Hour
+	maxInviteUses = 1000
+)
+
+type InviteService struct {
+	iRepo       *repository.InviteRepository
+	rRepo       *repository.RoomRepository
+	roomService *RoomService
+}
+
+func NewInviteService(inviteRepo *repository.InviteRepository, roomRepo *repository.RoomRepository, roomService *RoomService) *InviteService {
+	return &InviteService{
+		iRepo:       inviteRepo,
+		rRepo:       roomRepo,
+		roomService: roomService,
+	}
+}
+
+// 招待の作成条件
+type CreateInviteParams struct {
+	ExpiresIn int  `json:"expires_in"` // 有効期間（秒・0 なら無期限）
+	MaxUses   *int `json:"max_uses"`   // 使用回数の上限（省略で無制限）
+}
+
+// 招待リンクを発行（owner / admin のみ）
+func (s *InviteService) CreateInvite(userID uint, roomID uuid.UUID, params CreateInviteParams) (*model.RoomInvite, error) {
+	if _, _, err := s.roomService.authorize(userID, roomID.String(), PermInvite); err != nil {
+		return nil, err
+	}
+	if params.ExpiresIn < 0 || time.Duration(params.ExpiresIn)*time.Second > maxInviteTTL {
+		return nil, ErrInvalidInvite
+	}
+	if params.MaxUses != nil && (*params.MaxUses <= 0 || *params.MaxUses > maxInviteUses) {
+		return nil, ErrInvalidInvite
+	}
+
+	token, err := generateInviteToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	invite := &model.RoomInvite{
+		RoomID:    roomID,
+		Token:     token,
+		CreatedBy: userID,
+		CreatedAt: now,
+		MaxUses:   params.MaxUses,
+	}
+	if params.ExpiresIn > 0 {
+		expiresAt := now.Add(time.Duration(params.ExpiresIn) * time.Second)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	if err := s.iRepo.Create(invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// ルームの招待一覧（owner / admin のみ）
+func (s *InviteService) ListInvites(userID uint, roomID uuid.UUID) ([]model.RoomInvite, error) {
+	if _, _, err := s.roomService.authorize(userID, roomID.String(), PermInvite); err != nil {
+		return nil, err
+	}
+	return s.iRepo.ListByRoom(roomID.String())
+}
+
+// 招待を取り消す（owner / admin のみ）
+func (s *InviteService) RevokeInvite(userID uint, roomID uuid.UUID, inviteID uint) error {
+	if _, err := s.findRoomInvite(userID, roomID, inviteID); err != nil {
+		return err
+	}
+	return s.iRepo.Revoke(inviteID, time.Now())
+}
+
+// 招待から参加したユーザー（owner / admin のみ）
+func (s *InviteService) ListInviteUses(userID uint, roomID uuid.UUID, inviteID uint) ([]dto.InviteUse, error) {
+	if _, err := s.findRoomInvite(userID, roomID, inviteID); err != nil {
+		return nil, err
+	}
+	return s.iRepo.ListUses(inviteID)
+}
+
+// 参加前の確認（ルーム名と人数）
+func (s *InviteService) Preview(userID uint, token string) (*dto.InvitePreview, error) {
+	invite, room, err := s.findUsableInvite(token)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.rRepo.GetRoomMembers(room.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	preview := &dto.InvitePreview{
+		RoomID:      room.ID.String(),
+		DisplayName: room.DisplayName,
+		MemberCount: len(members),
+		ExpiresAt:   invite.ExpiresAt,
+	}
+	for _, m := range members {
+		if m.ID == userID {
+			preview.IsMember = true
+		}
+	}
+	return preview, nil
+}
+
+// 招待で参加（参加済みなら何もせず、Message が nil の結果を返す）
+func (s *InviteService) Accept(userID uint, userName string, token string) (*MembershipChange, error) {
+	invite, room, err := s.findUsableInvite(token)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &MembershipChange{
+		RoomID:  room.ID.String(),
+		ActorID: userID,
+		Users:   []dto.UserSummary{{ID: userID, Name: userName}},
+	}
+	ok, err := s.rRepo.InUserInRoom(userID, room.ID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return change, nil
+	}
+
+	msg := newSystemMessage(room.ID, userID, userName, fmt.Sprintf("%s が招待リンクから参加しました", userName))
+	err = s.iRepo.Accept(invite, userID, msg, time.Now())
+	if errors.Is(err, repository.ErrInviteUnavailable) {
+		return nil, ErrInviteUnavailable
+	}
+	// 同時に参加済みになっていれば、参加済みと同じ結果にする
+	if errors.Is(err, repository.ErrAlreadyMember) {
+		return change, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	change.Message = msg
+	return change, nil
+}
+
+// 使える招待とそのグループ（存在しなければ ErrInviteNotFound、使えなければ ErrInviteUnavailable）
+func (s *InviteService) findUsableInvite(token string) (*model.RoomInvite, *model.Room, error) {
+	invite, err := s.iRepo.FindByToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if invite == nil {
+		return nil, nil, ErrInviteNotFound
+	}
+	if !invite.Usable(time.Now()) {
+		return nil, nil, ErrInviteUnavailable
+	}
+
+	room, err := s.rRepo.FindRoomByID(invite.RoomID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	if room == nil || !room.IsGroup {
+		return nil, nil, ErrInviteNotFound
+	}
+	return invite, room, nil
+}
+
+// ルームの招待を取得（owner / admin のみ）
+func (s *InviteService) findRoomInvite(userID uint, roomID uuid.UUID, inviteID uint) (*model.RoomInvite, error) {
+	if _, _, err := s.roomService.authorize(userID, roomID.String(), PermInvite); err != nil {
+		return nil, err
+	}
+	invite, err := s.iRepo.FindByID(inviteID)
+	if err != nil {
+		return nil, err
+	}
+	if invite == nil || invite.RoomID != roomID {
+		return nil, ErrInviteNotFound
+	}
+	return invite, nil
+}
+
+// 推測されにくい招待トークン（URL にそのまま使える）
+func generateInviteToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
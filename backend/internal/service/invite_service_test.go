@@ -0,0 +1,61 @@
+package service_test
+
+import (
+	"chat-app/internal/model"
+	"chat-app/internal/repository"
+	"chat-app/internal/service"
+	"testing"
+)
+
+// 招待で参加 → 退会 → 同じ招待で再参加でき、参加の記録は2件残る
+func TestAcceptInviteAfterLeaving(t *testing.T) {
+	db := newTestDB(t)
+	roomSvc, roomRepo := newRoomService(db)
+	inviteSvc := service.NewInviteService(repository.NewInviteRepository(db), roomRepo, roomSvc)
+	users := createUsers(t, db, 3)
+	owner, guest := users[0], users[2]
+
+	roomID, err := roomSvc.CreateGroupRoom(owner.ID, []uint{users[1].ID}, "invite test")
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	cleanupRoom(t, db, roomID)
+	key := findRoom(t, roomRepo, roomID).Name
+
+	invite, err := inviteSvc.CreateInvite(owner.ID, roomID, service.CreateInviteParams{})
+	if err != nil {
+		t.Fatalf("create invite: %v", err)
+	}
+
+	change, err := inviteSvc.Accept(guest.ID, guest.Name, invite.Token)
+	if err != nil || change.Message == nil {
+		t.Fatalf("first accept = %+v, %v", change, err)
+	}
+	// 参加済みなら何もしない（二重に押しても 500 にならない）
+	change, err = inviteSvc.Accept(guest.ID, guest.Name, invite.Token)
+	if err != nil || change.Message != nil {
+		t.Fatalf("accept as member = %+v, %v", change, err)
+	}
+
+	if _, err := roomSvc.LeaveRoom(roomID.String(), guest.ID); err != nil {
+		t.Fatalf("leave: %v", err)
+	}
+	change, err = inviteSvc.Accept(guest.ID, guest.Name, invite.Token)
+	if err != nil || change.Message == nil {
+		t.Fatalf("rejoin = %+v, %v", change, err)
+	}
+
+	uses, err := inviteSvc.ListInviteUses(owner.ID, roomID, invite.ID)
+	if err != nil {
+		t.Fatalf("list uses: %v", err)
+	}
+	if len(uses) != 2 {
+		t.Fatalf("got %d uses, want 2", len(uses))
+	}
+	if got := findRoom(t, roomRepo, roomID).Name; got != key {
+		t.Fatalf("key changed on rejoin: %q → %q", key, got)
+	}
+	if role := memberRoles(t, db, roomID)[owner.ID]; role != model.RoomRoleOwner {
+		t.Fatalf("owner role = %q", role)
+	}
+}
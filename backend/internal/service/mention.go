@@ -0,0 +1,80 @@
+package service
+
+import (
+	"chat-app/internal/dto"
+	"chat-app/internal/model"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 全員宛てのメンション
+const mentionAll = "all"
+
+// 本文中の @名前 / @all をルームメンバーと照合し、メンション対象を返す（message_id は未設定）
+// 送信者自身は対象外。@all の場合は送信者以外の全メンバーを返す
+// IsAll は名前では指定されず、@all でのみ対象になったメンバーだけ true
+func ResolveMentions(content string, members []dto.UserSummary, senderID uint) ([]model.MessageMention, bool) {
+	// 長い名前を優先（"@bobby" を "bob" と誤認しない）
+	sorted := make([]dto.UserSummary, len(members))
+	copy(sorted, members)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i].Name) > len(sorted[j].Name) })
+
+	all := false
+	found := make(map[uint]bool)
+
+	for i := 0; i < len(content); i++ {
+		if content[i] != '@' || (i > 0 && isMentionWordByte(content[i-1])) {
+			continue
+		}
+		rest := content[i+1:]
+
+		if hasMentionPrefix(rest, mentionAll) {
+			all = true
+			continue
+		}
+		for _, m := range sorted {
+			if m.Name != "" && hasMentionPrefix(rest, m.Name) {
+				found[m.ID] = true
+				break
+			}
+		}
+	}
+
+	var mentions []model.MessageMention
+	for _, m := range members {
+		if m.ID == senderID {
+			continue
+		}
+		if all || found[m.ID] {
+			mentions = append(mentions, model.MessageMention{UserID: m.ID, IsAll: !found[m.ID]})
+		}
+	}
+	return mentions, all
+}
+
+// メンション対象のユーザーID
+func mentionedUserIDs(mentions []model.MessageMention) []uint {
+	var userIDs []uint
+	for _, m := range mentions {
+		userIDs = append(userIDs, m.UserID)
+	}
+	return userIDs
+}
+
+// s が name で始まり、その直後が単語の途中でないか
+func hasMentionPrefix(s, name string) bool {
+	if len(s) < len(name) || !strings.EqualFold(s[:len(name)], name) {
+		return false
+	}
+	if len(s) == len(name) {
+		return true
+	}
+	next, _ := utf8.DecodeRuneInString(s[len(name):])
+	return next >= utf8.RuneSelf || !isMentionWordByte(byte(next))
+}
+
+// メールアドレスや英単語の途中とみなす文字（ASCIIの英数字と _）
+func isMentionWordByte(b byte) bool {
+	return b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
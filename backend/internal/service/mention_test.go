@@ -0,0 +1,70 @@
+package service_test
+
+import (
+	"chat-app/internal/dto"
+	"chat-app/internal/model"
+	"chat-app/internal/service"
+	"reflect"
+	"testing"
+)
+
+func TestResolveMentions(t *testing.T) {
+	const senderID = 9
+	members := []dto.UserSummary{
+		{ID: 1, Name: "bob"},
+		{ID: 2, Name: "bobby"},
+		{ID: 3, Name: "Alice"},
+		{ID: 4, Name: "太郎"},
+		{ID: 5, Name: "Mary Ann"},
+		{ID: senderID, Name: "sender"},
+	}
+	named := func(ids ...uint) []model.MessageMention {
+		var mentions []model.MessageMention
+		for _, id := range ids {
+			mentions = append(mentions, model.MessageMention{UserID: id})
+		}
+		return mentions
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []model.MessageMention
+		wantAll bool
+	}{
+		{"name", "@bob こんにちは", named(1), false},
+		{"longest name first", "@bobby hi", named(2), false},
+		{"both names", "@bob と @bobby", named(1, 2), false},
+		{"duplicate", "@bob @bob", named(1), false},
+		{"case insensitive", "@ALICE お願いします", named(3), false},
+		{"name with space", "@Mary Ann 確認して", named(5), false},
+		{"japanese name followed by japanese", "@太郎さん、確認を", named(4), false},
+		{"after japanese text", "こんにちは@bob", named(1), false},
+		{"punctuation after name", "(@bob), ok", named(1), false},
+		{"inside word", "@bobbyx", nil, false},
+		{"underscore after name", "@bob_x", nil, false},
+		{"email address", "mail bob@bob.com", nil, false},
+		{"sender", "@sender メモ", nil, false},
+		{"unknown name", "@carol", nil, false},
+		{"all word prefix", "@alliance", nil, false},
+		{"no mention", "bob と alice", nil, false},
+		{
+			"all", "@all 集合",
+			[]model.MessageMention{{UserID: 1, IsAll: true}, {UserID: 2, IsAll: true}, {UserID: 3, IsAll: true}, {UserID: 4, IsAll: true}, {UserID: 5, IsAll: true}},
+			true,
+		},
+		{
+			"all and name", "@ALL 特に @bob",
+			[]model.MessageMention{{UserID: 1}, {UserID: 2, IsAll: true}, {UserID: 3, IsAll: true}, {UserID: 4, IsAll: true}, {UserID: 5, IsAll: true}},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, all := service.ResolveMentions(tt.content, members, senderID)
+			if !reflect.DeepEqual(got, tt.want) || all != tt.wantAll {
+				t.Errorf("ResolveMentions(%q) = %+v, %v; want %+v, %v", tt.content, got, all, tt.want, tt.wantAll)
+			}
+		})
+	}
+}
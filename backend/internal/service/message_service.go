@@ -0,0 +1,524 @@
+package service
+
+import (
+	"chat-app/internal/dto"
+	"chat-app/internal/model"
+	"chat-app/internal/repository"
+	"chat-app/internal/storage"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMessageNotFound   = errors.New("message not found")
+	ErrNotMessageSender  = errors.New("only the sender can modify this message")
+	ErrEmptyContent      = errors.New("content is empty")
+	ErrRoomAccessDenied  = errors.New("unauthorized access to room")
+	ErrMessageDeleted    = errors.New("message has been deleted")
+	ErrInvalidParent     = errors.New("invalid thread parent")
+	ErrInvalidEmoji      = errors.New("invalid emoji")
+	ErrInvalidAttachment = errors.New("invalid attachment")
+	ErrInvalidSearch     = errors.New("invalid search query")
+	ErrInvalidClientID   = errors.New("invalid client_id")
+	ErrSystemMessage     = errors.New("system messages cannot be modified")
+)
+
+// 1メッセージに添付できるファイル数
+const maxAttachmentsPerMessage = 10
+
+// client_id の最大長
+const maxClientIDLength = 64
+
+// 検索の件数・クエリ長の上限
+const (
+	defaultSearchLimit   = 20
+	maxSearchLimit       = 50
+	maxSearchQueryLength = 200
+)
+
+type MessageService struct {
+	mRepo *repository.MessageRepository
+	rRepo *repository.RoomRepository
+	aRepo *repository.AttachmentRepository
+	// 全員から削除したメッセージの添付ファイルを消す
+	storage storage.Storage
+}
+
+func NewMessageService(messageRepo *repository.MessageRepository, roomRepo *repository.RoomRepository, attachmentRepo *repository.AttachmentRepository, store storage.Storage) *MessageService {
+	return &MessageService{
+		mRepo:   messageRepo,
+		rRepo:   roomRepo,
+		aRepo:   attachmentRepo,
+		storage: store,
+	}
+}
+
+// 送信内容
+type SendParams struct {
+	Content       string
+	ParentID      *uint       // スレッド返信なら親メッセージID
+	AttachmentIDs []uuid.UUID // アップロード済みの添付ファイル
+	ClientID      string      // クライアント採番のID（同じ値の再送は保存済みのメッセージを返す）
+}
+
+// メッセージ送信
+// 2つ目の戻り値は client_id が重複していたか（true なら保存済みのメッセージを返す）
+func (s *MessageService) SendMessage(userID uint, userName string, roomID uuid.UUID, params SendParams) (*model.Message, bool, error) {
+	// 添付ファイルのみのメッセージは本文なしでも可
+	if strings.TrimSpace(params.Content) == "" && len(params.AttachmentIDs) == 0 {
+		return nil, false, ErrEmptyContent
+	}
+	if len(params.ClientID) > maxClientIDLength {
+		return nil, false, ErrInvalidClientID
+	}
+
+	// 退会・削除されたルームには送信不可（接続が残っていても、送信のたびに確認する）
+	ok, err := s.rRepo.InUserInRoom(userID, roomID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, ErrRoomAccessDenied
+	}
+
+	// 再送なら保存済みのメッセージを返す
+	if params.ClientID != "" {
+		existing, err := s.findByClientID(userID, roomID, params.ClientID)
+		if err != nil || existing != nil {
+			return existing, existing != nil, err
+		}
+	}
+
+	if params.ParentID != nil {
+		parent, err := s.mRepo.FindMessageByID(*params.ParentID)
+		if err != nil {
+			return nil, false, err
+		}
+		// 親は同じルームの未削除トップレベルメッセージのみ（スレッドは1階層）
+		if parent == nil || parent.RoomID != roomID || parent.ParentID != nil || parent.DeletedAt != nil {
+			return nil, false, ErrInvalidParent
+		}
+	}
+
+	attachmentIDs := uniqueUUIDs(params.AttachmentIDs)
+	if len(attachmentIDs) > maxAttachmentsPerMessage {
+		return nil, false, ErrInvalidAttachment
+	}
+	if len(attachmentIDs) > 0 {
+		// 自分がこのルームにアップロードした未送信のものだけ添付可
+		count, err := s.aRepo.CountLinkable(attachmentIDs, roomID, userID)
+		if err != nil {
+			return nil, false, err
+		}
+		if count != len(attachmentIDs) {
+			return nil, false, ErrInvalidAttachment
+		}
+	}
+
+	msg := &model.Message{
+		RoomID:   roomID,
+		SenderID: userID,
+		Sender:   userName,
+		Content:  params.Content,
+		Kind:     model.MessageKindText,
+		ParentID: params.ParentID,
+	}
+	if params.ClientID != "" {
+		msg.ClientID = &params.ClientID
+	}
+
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	msg.CreatedAt = time.Now().In(loc)
+
+	// メンションは保存前に解決し、添付ファイルの紐付けとあわせてメッセージと同時に保存する
+	members, err := s.rRepo.GetRoomMembers(roomID.String())
+	if err != nil {
+		return nil, false, err
+	}
+	mentions, mentionAll := ResolveMentions(msg.Content, members, msg.SenderID)
+
+	saved, err := s.mRepo.SaveMessage(msg, attachmentIDs, mentions)
+	// 確認の後に、同時に送信された別のメッセージへ紐付けられていた
+	if errors.Is(err, repository.ErrAttachmentUnavailable) {
+		return nil, false, ErrInvalidAttachment
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	// 同時に再送された場合は先に保存された方を返す
+	if !saved {
+		existing, err := s.findByClientID(userID, roomID, params.ClientID)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing == nil {
+			return nil, false, ErrMessageNotFound
+		}
+		return existing, true, nil
+	}
+
+	msg.Mentions = mentionedUserIDs(mentions)
+	msg.MentionAll = mentionAll
+
+	// 保存は済んでいるので、添付ファイルの取得に失敗してもエラーにはしない（配信を止めない）
+	if len(attachmentIDs) > 0 {
+		linked := []model.Message{*msg}
+		if err := s.mRepo.AttachAttachments(linked); err == nil {
+			msg.Attachments = linked[0].Attachments
+		}
+	}
+	return msg, false, nil
+}
+
+// client_id で保存済みのメッセージを探す（添付・リアクション等も付与）
+func (s *MessageService) findByClientID(userID uint, roomID uuid.UUID, clientID string) (*model.Message, error) {
+	msg, err := s.mRepo.FindMessageByClientID(roomID, userID, clientID)
+	if err != nil || msg == nil {
+		return nil, err
+	}
+	messages := []model.Message{*msg}
+	if err := s.mRepo.AttachDetails(messages, userID); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// スレッド取得（親メッセージと返信）
+func (s *MessageService) GetThread(userID uint, roomID uuid.UUID, parentID uint, before string, limit int) (*model.Message, []model.Message, error) {
+	parent, err := s.findRoomMessage(userID, parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if parent.RoomID != roomID || parent.ParentID != nil {
+		return nil, nil, ErrMessageNotFound
+	}
+
+	replies, err := s.mRepo.GetThreadRepliesBefore(parentID, userID, before, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	thread := append([]model.Message{*parent}, replies...)
+	if err := s.mRepo.AttachDetails(thread, userID); err != nil {
+		return nil, nil, err
+	}
+	return &thread[0], thread[1:], nil
+}
+
+// 自分宛てのメンション一覧
+func (s *MessageService) GetMentions(userID uint, userName string, before string, limit int) ([]dto.MentionItem, error) {
+	items, err := s.mRepo.GetMentionsForUser(userID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].RoomName = roomDisplayNameFor(items[i].RoomName, items[i].IsGroup, userName)
+	}
+	return items, nil
+}
+
+// メッセージ検索（所属中のルームのみ）
+func (s *MessageService) Search(userID uint, userName string, params dto.SearchParams) (*dto.SearchResponse, error) {
+	params.Query = strings.TrimSpace(params.Query)
+	if params.Query == "" || utf8.RuneCountInString(params.Query) > maxSearchQueryLength {
+		return nil, ErrInvalidSearch
+	}
+	if params.Limit <= 0 || params.Limit > maxSearchLimit {
+		params.Limit = defaultSearchLimit
+	}
+
+	results, err := s.mRepo.SearchMessages(userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dto.SearchResponse{Results: []dto.SearchResult{}}
+	if len(results) > params.Limit {
+		results = results[:params.Limit]
+		last := results[len(results)-1]
+		resp.NextCursor = EncodeSearchCursor(dto.SearchCursor{CreatedAt: last.CreatedAt, ID: last.MessageID})
+	}
+	for i := range results {
+		results[i].RoomName = roomDisplayNameFor(results[i].RoomName, results[i].IsGroup, userName)
+	}
+	if results != nil {
+		resp.Results = results
+	}
+	return resp, nil
+}
+
+// 検索カーソルを文字列化（base64url の "作成日時|ID"）
+func EncodeSearchCursor(cursor dto.SearchCursor) string {
+	raw := cursor.CreatedAt.Format(time.RFC3339Nano) + "|" + strconv.FormatUint(uint64(cursor.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// 検索カーソルの復元
+func DecodeSearchCursor(s string) (*dto.SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidSearch
+	}
+	createdAtStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidSearch
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return nil, ErrInvalidSearch
+	}
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSearch
+	}
+	return &dto.SearchCursor{CreatedAt: createdAt, ID: uint(id)}, nil
+}
+
+// 本文のメンションを解決して保存
+func (s *MessageService) saveMentions(msg *model.Message) error {
+	members, err := s.rRepo.GetRoomMembers(msg.RoomID.String())
+	if err != nil {
+		return err
+	}
+
+	mentions, all := ResolveMentions(msg.Content, members, msg.SenderID)
+	if err := s.mRepo.ReplaceMentions(msg.ID, mentions); err != nil {
+		return err
+	}
+
+	msg.Mentions = mentionedUserIDs(mentions)
+	msg.MentionAll = all
+	return nil
+}
+
+// メッセージ編集（送信者本人のみ）
+func (s *MessageService) EditMessage(userID uint, messageID uint, content string) (*model.Message, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, ErrEmptyContent
+	}
+
+	msg, err := s.findOwnMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 変更なしならそのまま返す
+	if msg.Content == content {
+		return msg, nil
+	}
+
+	if err := s.mRepo.UpdateMessageContent(msg, content); err != nil {
+		return nil, err
+	}
+
+	// 編集後の本文でメンションを付け直す
+	if err := s.saveMentions(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// 全員から削除（送信者本人のみ）
+// 戻り値は削除後のメッセージと再計算されたルームの last_message
+func (s *MessageService) DeleteForEveryone(userID uint, messageID uint) (*model.Message, string, error) {
+	msg, err := s.findOwnMessage(userID, messageID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	lastMessage, attachments, err := s.mRepo.DeleteMessageForEveryone(msg)
+	if err != nil {
+		return nil, "", err
+	}
+	s.deleteStoredFiles(attachments)
+	return msg, lastMessage, nil
+}
+
+// 自分だけ削除（ルームメンバーなら誰のメッセージでも可）
+func (s *MessageService) HideForUser(userID uint, messageID uint) (*model.Message, error) {
+	msg, err := s.findRoomMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mRepo.HideMessageForUser(msg.ID, userID); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// リアクション追加・削除の結果
+type ReactionChange struct {
+	MessageID uint      `json:"message_id"`
+	RoomID    uuid.UUID `json:"room_id"`
+	UserID    uint      `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	Action    string    `json:"action"` // "add" or "remove"
+	Count     int       `json:"count"`  // 変更後の件数
+	Changed   bool      `json:"-"`      // 既に同じ状態なら false
+}
+
+// リアクション追加（ルームメンバーのみ）
+func (s *MessageService) AddReaction(userID uint, messageID uint, emoji string) (*ReactionChange, error) {
+	return s.changeReaction(userID, messageID, emoji, "add")
+}
+
+// リアクション削除（自分のリアクションのみ）
+func (s *MessageService) RemoveReaction(userID uint, messageID uint, emoji string) (*ReactionChange, error) {
+	return s.changeReaction(userID, messageID, emoji, "remove")
+}
+
+func (s *MessageService) changeReaction(userID uint, messageID uint, emoji string, action string) (*ReactionChange, error) {
+	emoji = strings.TrimSpace(emoji)
+	if !isValidEmoji(emoji) {
+		return nil, ErrInvalidEmoji
+	}
+
+	msg, err := s.findRoomMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+
+	var changed bool
+	if action == "add" {
+		changed, err = s.mRepo.AddReaction(msg.ID, userID, emoji)
+	} else {
+		changed, err = s.mRepo.RemoveReaction(msg.ID, userID, emoji)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.mRepo.CountReactions(msg.ID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReactionChange{
+		MessageID: msg.ID,
+		RoomID:    msg.RoomID,
+		UserID:    userID,
+		Emoji:     emoji,
+		Action:    action,
+		Count:     count,
+		Changed:   changed,
+	}, nil
+}
+
+// 絵文字として受け付ける文字列か（空白・制御文字を含まない短い文字列）
+func isValidEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > 64 || utf8.RuneCountInString(emoji) > 16 {
+		return false
+	}
+	for _, r := range emoji {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// 編集履歴取得（ルームメンバーのみ）
+func (s *MessageService) GetEditHistory(userID uint, roomID uuid.UUID, messageID uint) ([]model.MessageEdit, error) {
+	msg, err := s.findRoomMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.RoomID != roomID {
+		return nil, ErrMessageNotFound
+	}
+
+	return s.mRepo.GetMessageEdits(messageID)
+}
+
+// メッセージを既読にしたメンバー（送信者本人と、既読を知らせない設定のユーザーは含めない）
+func (s *MessageService) GetSeenBy(userID uint, roomID uuid.UUID, messageID uint) ([]dto.SeenBy, error) {
+	msg, err := s.findRoomMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.RoomID != roomID {
+		return nil, ErrMessageNotFound
+	}
+
+	return s.rRepo.GetSeenBy(roomID, messageID, msg.SenderID)
+}
+
+// ルームメンバーが参照できるメッセージを取得
+func (s *MessageService) findRoomMessage(userID uint, messageID uint) (*model.Message, error) {
+	msg, err := s.mRepo.FindMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	// 退会済みのルームのメッセージは操作不可
+	ok, err := s.rRepo.InUserInRoom(userID, msg.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRoomAccessDenied
+	}
+	return msg, nil
+}
+
+// 自分が送信した未削除のメッセージを取得
+func (s *MessageService) findOwnMessage(userID uint, messageID uint) (*model.Message, error) {
+	msg, err := s.findRoomMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != userID {
+		return nil, ErrNotMessageSender
+	}
+	if msg.Kind == model.MessageKindSystem {
+		return nil, ErrSystemMessage
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	return msg, nil
+}
+
+// 添付ファイルの保存先のファイルを消す（行は削除済みなので、失敗しても取得はできない）
+func (s *MessageService) deleteStoredFiles(attachments []model.Attachment) {
+	for _, a := range attachments {
+		keys := []string{a.StorageKey}
+		if a.ThumbnailKey != nil {
+			keys = append(keys, *a.ThumbnailKey)
+		}
+		for _, key := range keys {
+			if err := s.storage.Delete(context.Background(), key); err != nil {
+				log.Println("添付ファイルの削除失敗:", key, err)
+			}
+		}
+	}
+}
+
+// 重複を除いたID一覧（順序は維持）
+func uniqueUUIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	var result []uuid.UUID
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package service_test
+
+import (
+	"chat-app/internal/dto"
+	"chat-app/internal/repository"
+	"chat-app/internal/service"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+// カーソルは作成日時（ナノ秒まで）と ID を保ったまま復元できる
+func TestSearchCursorRoundTrip(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	cursors := []dto.SearchCursor{
+		{CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 123456789, jst), ID: 42},
+		{CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ID: 1},
+		{CreatedAt: time.Date(1999, 12, 31, 23, 59, 59, 999999000, jst), ID: 4294967295},
+	}
+	for _, want := range cursors {
+		encoded := service.EncodeSearchCursor(want)
+		got, err := service.DecodeSearchCursor(encoded)
+		if err != nil {
+			t.Fatalf("decode %q: %v", encoded, err)
+		}
+		if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+			t.Errorf("round trip %+v → %q → %+v", want, encoded, got)
+		}
+	}
+}
+
+func TestDecodeSearchCursorInvalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	inputs := []string{
+		"",
+		"!!!",
+		base64.StdEncoding.EncodeToString([]byte("2024-01-02T03:04:05Z|1")) + "=",
+		encode("2024-01-02T03:04:05Z"),
+		encode("2024-01-02T03:04:05Z|"),
+		encode("2024-01-02T03:04:05Z|abc"),
+		encode("2024-01-02T03:04:05Z|-1"),
+		encode("2024-01-02 03:04:05|1"),
+		encode("|1"),
+	}
+	for _, s := range inputs {
+		if _, err := service.DecodeSearchCursor(s); !errors.Is(err, service.ErrInvalidSearch) {
+			t.Errorf("DecodeSearchCursor(%q) err = %v, want ErrInvalidSearch", s, err)
+		}
+	}
+}
+
+// 日本語の語は単語に分かれないため、部分一致でヒットし、除外指定も効く
+func TestSearchJapaneseSubstring(t *testing.T) {
+	db := newTestDB(t)
+	roomSvc, roomRepo := newRoomService(db)
+	msgSvc := service.NewMessageService(repository.NewMessageRepository(db), roomRepo, repository.NewAttachmentRepository(db), nil)
+	users := createUsers(t, db, 2)
+	sender := users[0]
+
+	roomID, err := roomSvc.CreateGroupRoom(sender.ID, []uint{users[1].ID}, "search")
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	cleanupRoom(t, db, roomID)
+
+	contents := []string{"明日の会議は10時からです", "会議は中止になりました", "ランチに行きましょう"}
+	ids := make([]uint, len(contents))
+	for i, content := range contents {
+		msg, _, err := msgSvc.SendMessage(sender.ID, sender.Name, roomID, service.SendParams{Content: content})
+		if err != nil {
+			t.Fatalf("send %q: %v", content, err)
+		}
+		ids[i] = msg.ID
+	}
+
+	search := func(query string) []uint {
+		t.Helper()
+		resp, err := msgSvc.Search(users[1].ID, users[1].Name, dto.SearchParams{Query: query, RoomID: &roomID})
+		if err != nil {
+			t.Fatalf("search %q: %v", query, err)
+		}
+		var got []uint
+		for _, r := range resp.Results {
+			got = append(got, r.MessageID)
+		}
+		return got
+	}
+
+	// 新しい順
+	if got := search("会議"); len(got) != 2 || got[0] != ids[1] || got[1] != ids[0] {
+		t.Errorf("search 会議 = %v, want [%d %d]", got, ids[1], ids[0])
+	}
+	if got := search("会議 -中止"); len(got) != 1 || got[0] != ids[0] {
+		t.Errorf("search 会議 -中止 = %v, want [%d]", got, ids[0])
+	}
+	if got := search("会議 ランチ"); len(got) != 0 {
+		t.Errorf("search 会議 ランチ = %v, want none", got)
+	}
+}
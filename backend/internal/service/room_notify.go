@@ -0,0 +1,91 @@
+package service
+
+import (
+	"chat-app/internal/model"
+	"errors"
+	"time"
+)
+
+var ErrInvalidNotifySettings = errors.New("invalid notification settings")
+
+// ルームごとの通知設定
+type RoomNotifySettings struct {
+	RoomID      string     `json:"room_id"`
+	NotifyLevel string     `json:"notify_level"`
+	MutedUntil  *time.Time `json:"muted_until"`
+}
+
+// 自分の通知設定（期限切れのミュートは all として返す）
+func (s *RoomService) GetNotifySettings(userID uint, roomID string) (*RoomNotifySettings, error) {
+	member, err := s.rRepo.FindMembership(roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrRoomAccessDenied
+	}
+	return effectiveNotifySettings(roomID, member.NotifyLevel, member.MutedUntil, time.Now()), nil
+}
+
+// 通知設定を変更
+// mutedUntil は muted のときだけ指定でき、未来の時刻でなければならない（nil なら無期限）
+func (s *RoomService) UpdateNotifySettings(userID uint, roomID string, level string, mutedUntil *time.Time) (*RoomNotifySettings, error) {
+	switch level {
+	case model.NotifyLevelAll, model.NotifyLevelMentions, model.NotifyLevelMuted:
+	default:
+		return nil, ErrInvalidNotifySettings
+	}
+	now := time.Now()
+	if mutedUntil != nil && (level != model.NotifyLevelMuted || !mutedUntil.After(now)) {
+		return nil, ErrInvalidNotifySettings
+	}
+
+	member, err := s.rRepo.FindMembership(roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrRoomAccessDenied
+	}
+	if err := s.rRepo.SetNotifySettings(roomID, userID, level, mutedUntil); err != nil {
+		return nil, err
+	}
+	return effectiveNotifySettings(roomID, level, mutedUntil, now), nil
+}
+
+// 新着メッセージの通知先を決めるための、メンバーごとの通知設定（all のメンバーは含まない）
+func (s *RoomService) NotifyLevels(roomID string) (map[uint]string, error) {
+	members, err := s.rRepo.GetNotifySettings(roomID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	levels := make(map[uint]string, len(members))
+	for _, m := range members {
+		levels[m.UserID] = model.EffectiveNotifyLevel(m.NotifyLevel, m.MutedUntil, now)
+	}
+	return levels, nil
+}
+
+// 通知設定でそのメッセージを通知するか
+func ShouldNotify(level string, mentioned bool) bool {
+	switch level {
+	case model.NotifyLevelMuted:
+		return false
+	case model.NotifyLevelMentions:
+		return mentioned
+	default:
+		return true
+	}
+}
+
+func effectiveNotifySettings(roomID string, level string, mutedUntil *time.Time, now time.Time) *RoomNotifySettings {
+	settings := &RoomNotifySettings{
+		RoomID:      roomID,
+		NotifyLevel: model.EffectiveNotifyLevel(level, mutedUntil, now),
+	}
+	if settings.NotifyLevel == model.NotifyLevelMuted {
+		settings.MutedUntil = mutedUntil
+	}
+	return settings
+}
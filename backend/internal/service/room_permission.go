@@ -0,0 +1,89 @@
+package service
+
+import (
+	"chat-app/internal/model"
+	"errors"
+)
+
+var (
+	ErrPermissionDenied = errors.New("insufficient room permissions")
+	ErrInvalidRole      = errors.New("invalid role")
+)
+
+// ルームでの操作
+const (
+	PermRename        = "rename"
+	PermEditInfo      = "edit_info" // チャンネルのトピック・説明の変更
+	PermDelete        = "delete"
+	PermAddMembers    = "add_members"
+	PermRemoveMembers = "remove_members"
+	PermPin           = "pin"
+	PermManageRoles   = "manage_roles" // admin の任命・解任、owner の譲渡
+	PermInvite        = "invite"       // 招待リンクの発行・取り消し・参加記録の閲覧
+)
+
+// グループで役割ごとにできる操作
+var rolePermissions = map[string]map[string]bool{
+	model.RoomRoleOwner: {
+		PermRename:        true,
+		PermEditInfo:      true,
+		PermDelete:        true,
+		PermAddMembers:    true,
+		PermRemoveMembers: true,
+		PermPin:           true,
+		PermManageRoles:   true,
+		PermInvite:        true,
+	},
+	model.RoomRoleAdmin: {
+		PermRename:        true,
+		PermEditInfo:      true,
+		PermAddMembers:    true,
+		PermRemoveMembers: true,
+		PermPin:           true,
+		PermInvite:        true,
+	},
+	model.RoomRoleMember: {},
+}
+
+// 1対1ルームでできる操作（役割はなく、両者とも同じ）
+var oneToOnePermissions = map[string]bool{
+	PermDelete: true,
+	PermPin:    true,
+}
+
+// 役割の強さ（メンバーを削除できるのは自分より弱い役割の相手だけ）
+var roleRank = map[string]int{
+	model.RoomRoleOwner:  3,
+	model.RoomRoleAdmin:  2,
+	model.RoomRoleMember: 1,
+}
+
+// 操作の権限を確認し、ルームと操作するユーザーのメンバー情報を返す
+// 存在しないルームはメンバーでない場合と同じく ErrRoomAccessDenied
+func (s *RoomService) authorize(userID uint, roomID string, perm string) (*model.Room, *model.RoomMember, error) {
+	member, err := s.rRepo.FindMembership(roomID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if member == nil {
+		return nil, nil, ErrRoomAccessDenied
+	}
+	room, err := s.rRepo.FindRoomByID(roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if room == nil {
+		return nil, nil, ErrRoomAccessDenied
+	}
+
+	if !room.IsGroup {
+		if !oneToOnePermissions[perm] {
+			return nil, nil, ErrNotGroupRoom
+		}
+		return room, member, nil
+	}
+	if !rolePermissions[member.Role][perm] {
+		return nil, nil, ErrPermissionDenied
+	}
+	return room, member, nil
+}
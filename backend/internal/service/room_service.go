@@ -5,10 +5,12 @@ import (
 	"chat-app/internal/model"
 	"chat-app/internal/repository"
 	"errors"
+	"fmt"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -37,12 +39,17 @@ func (s *RoomService) AuthorizeUser(userID uint, roomID uuid.UUID) error {
 	return nil
 }
 
-func (s *RoomService) CreateOneToOneRoomIfNotExists(userAID, userBID uint) (uuid.UUID, error) {
+// 1対1のルームは相手ごとに1つ
+// reuseExisting が false のときに既存のルームがあれば ErrRoomExists と既存のルームIDを返す
+func (s *RoomService) CreateOneToOneRoomIfNotExists(userAID, userBID uint, reuseExisting bool) (uuid.UUID, error) {
     existing, err := s.rRepo.FindRoomByUsers(userAID, userBID)
     if err != nil {
         return uuid.Nil, err
     }
     if existing != nil {
+        if !reuseExisting {
+            return existing.ID, ErrRoomExists
+        }
         return existing.ID, nil
     }
 
@@ -70,7 +77,7 @@ func (s *RoomService) CreateOneToOneRoomIfNotExists(userAID, userBID uint) (uuid
         CreatedAt:   time.Now(),
     }
 
-    if err := s.rRepo.CreateRoom(room, []uint{userAID, userBID}); err != nil {
+    if err := s.rRepo.CreateRoom(room, []uint{userAID, userBID}, 0); err != nil {
         return uuid.Nil, err
     }
 
@@ -79,28 +86,30 @@ func (s *RoomService) CreateOneToOneRoomIfNotExists(userAID, userBID uint) (uuid
 
 
 
-func (s *RoomService) CreateGroupRoomIfNotExists(creatorID uint, userIDs []uint, displayName string) (uuid.UUID, error) {
-    allUserIDs := append(userIDs, creatorID)
-    groupKey := GenerateGroupNameFromUserIDs(allUserIDs)
-
-    // nameによる検索（高速で確実）
-    existing, err := s.rRepo.FindGroupRoomByName(groupKey)
-    if err != nil {
-        return uuid.Nil, err
-    }
-    if existing != nil {
-        return existing.ID, nil
+// グループは毎回新しく作る（同じメンバーでも別のグループ）
+func (s *RoomService) CreateGroupRoom(creatorID uint, userIDs []uint, displayName string) (uuid.UUID, error) {
+    // 重複と作成者自身を除いてから作成者を加える
+    seen := map[uint]bool{creatorID: true}
+    allUserIDs := []uint{creatorID}
+    for _, id := range userIDs {
+        if id == 0 || seen[id] {
+            continue
+        }
+        seen[id] = true
+        allUserIDs = append(allUserIDs, id)
     }
 
+    roomID := uuid.New()
     room := &model.Room{
-        ID:          uuid.New(),
+        ID:          roomID,
         IsGroup:     true,
-        Name:        groupKey,
+        Name:        "group_" + roomID.String(), // 内部識別キー（メンバー構成には依存しない）
         DisplayName: displayName, // ← 初期表示用
         CreatedAt:   time.Now(),
     }
 
-    if err := s.rRepo.CreateRoom(room, allUserIDs); err != nil {
+    // 作成者が owner
+    if err := s.rRepo.CreateRoom(room, allUserIDs, creatorID); err != nil {
         return uuid.Nil, err
     }
 
@@ -112,6 +121,7 @@ func (s *RoomService) GetRoomsForUser(userID uint) ([]repository.RoomListItem, e
     return s.rRepo.GetRoomByUser(userID)
 }
 
+// 1対1ルームの内部キー用（グループのキーには使わない）
 func GenerateGroupNameFromUserIDs(userIDs []uint) string {
     sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
     var parts []string
@@ -132,33 +142,169 @@ func (s *RoomService) GetUserRoomsWithUnread(userID uint) ([]dto.RoomWithUnread,
         return nil, err
     }
 
+    now := time.Now()
     for i, room := range rooms {
-
-        if !room.IsGroup {
-            names := strings.Split(room.DisplayName, ",")
-            var others []string
-            for _, name := range names {
-                if strings.TrimSpace(name) != user.Name {
-                    others = append(others, strings.TrimSpace(name))
-                }
-            }
-            rooms[i].DisplayName = strings.Join(others, ", ")
+        rooms[i].DisplayName = roomDisplayNameFor(room.DisplayName, room.IsGroup, user.Name)
+        // 期限切れのミュートは解除済みとして返す
+        rooms[i].NotifyLevel = model.EffectiveNotifyLevel(room.NotifyLevel, room.MutedUntil, now)
+        if rooms[i].NotifyLevel != model.NotifyLevelMuted {
+            rooms[i].MutedUntil = nil
         }
     }
 
     return rooms, nil
 }
 
+// 1対1ルームは「A, B」から自分の名前を除いた相手の名前を表示名にする
+func roomDisplayNameFor(displayName string, isGroup bool, userName string) string {
+    if isGroup {
+        return displayName
+    }
 
-// 既読管理
-func (s *RoomService) MarkAsRead(userID uint, roomID string) error {
-    return s.rRepo.UpsertRoomRead(userID, roomID)
+    names := strings.Split(displayName, ",")
+    var others []string
+    for _, name := range names {
+        if strings.TrimSpace(name) != userName {
+            others = append(others, strings.TrimSpace(name))
+        }
+    }
+    return strings.Join(others, ", ")
+}
+
+
+// 既読にするメッセージがルームのものでない
+var ErrInvalidReadPosition = errors.New("message does not belong to room")
+
+// 既読位置の更新結果
+type ReadReceipt struct {
+    RoomID    string    `json:"room_id"`
+    UserID    uint      `json:"user_id"`
+    MessageID uint      `json:"message_id"` // 更新後の既読位置
+    ReadAt    time.Time `json:"read_at"`
+
+    Advanced  bool `json:"-"` // 既読位置が進んだ
+    Broadcast bool `json:"-"` // 他のメンバーに知らせる（進んでいて、本人が既読を知らせる設定）
+
+    Status *MessageStatusUpdate `json:"-"` // 1対1ルームで相手のメッセージの配信状況が変わった
+}
+
+// 1対1ルームの配信状況の変化（送信者へ通知する）
+type MessageStatusUpdate struct {
+    RoomID    string    `json:"room_id"`
+    SenderID  uint      `json:"-"`          // 通知先（メッセージの送信者）
+    MessageID uint      `json:"message_id"` // このメッセージまでが Status になった
+    Status    string    `json:"status"`
+    At        time.Time `json:"at"`
+}
+
+// 既読管理（messageID が 0 ならルームの最新メッセージまで）
+func (s *RoomService) MarkAsRead(userID uint, roomID string, messageID uint) (*ReadReceipt, error) {
+    if messageID == 0 {
+        latest, err := s.rRepo.LatestMessageID(roomID)
+        if err != nil {
+            return nil, err
+        }
+        messageID = latest
+    } else {
+        ok, err := s.rRepo.MessageInRoom(messageID, roomID)
+        if err != nil {
+            return nil, err
+        }
+        if !ok {
+            return nil, ErrInvalidReadPosition
+        }
+    }
+
+    receipt := &ReadReceipt{RoomID: roomID, UserID: userID, ReadAt: time.Now()}
+    // メッセージのないルームは既読にするものがない
+    if messageID == 0 {
+        return receipt, nil
+    }
+
+    current, advanced, err := s.rRepo.AdvanceRoomRead(userID, roomID, messageID, receipt.ReadAt)
+    if err != nil {
+        return nil, err
+    }
+    receipt.MessageID = current
+    receipt.Advanced = advanced
+
+    if advanced {
+        settings, err := s.uRepo.GetSettings(userID)
+        if err != nil {
+            return nil, err
+        }
+        receipt.Broadcast = settings.ReadReceiptsEnabled
+
+        // 既読を知らせない設定なら、1対1ルームでも配信済みまでにとどめる
+        status := model.MessageStatusDelivered
+        if settings.ReadReceiptsEnabled {
+            status = model.MessageStatusRead
+        }
+        receipt.Status, err = s.updateMessageStatus(userID, roomID, current, status, receipt.ReadAt)
+        if err != nil {
+            return nil, err
+        }
+    }
+    return receipt, nil
+}
+
+// 通知を受け取ったことの確認（1対1ルームなら相手のメッセージを配信済みにする）
+// 状況が変わらなければ nil
+func (s *RoomService) MarkDelivered(userID uint, roomID string, messageID uint) (*MessageStatusUpdate, error) {
+    return s.updateMessageStatus(userID, roomID, messageID, model.MessageStatusDelivered, time.Now())
+}
+
+func (s *RoomService) updateMessageStatus(userID uint, roomID string, messageID uint, status string, at time.Time) (*MessageStatusUpdate, error) {
+    var changed bool
+    var err error
+    if status == model.MessageStatusRead {
+        changed, err = s.rRepo.MarkMessagesRead(roomID, userID, messageID, at)
+    } else {
+        changed, err = s.rRepo.MarkMessagesDelivered(roomID, userID, messageID, at)
+    }
+    if err != nil || !changed {
+        return nil, err
+    }
+
+    // 1対1ルームなので、自分以外のメンバーが送信者
+    members, err := s.rRepo.GetRoomMembers(roomID)
+    if err != nil {
+        return nil, err
+    }
+    for _, m := range members {
+        if m.ID != userID {
+            return &MessageStatusUpdate{RoomID: roomID, SenderID: m.ID, MessageID: messageID, Status: status, At: at}, nil
+        }
+    }
+    // 相手が退会済みなら通知先がない
+    return nil, nil
+}
+
+// 1対1ルームか（ルームがなければ false）
+func (s *RoomService) IsOneToOne(roomID string) (bool, error) {
+    room, err := s.rRepo.FindRoomByID(roomID)
+    if err != nil || room == nil {
+        return false, err
+    }
+    return !room.IsGroup, nil
 }
 
 // グループ名変更
 func (s *RoomService) UpdateRoomName(userID uint, roomID string, name string) error {
-    // 権限チェックがあればここで（省略可）
-    return s.rRepo.UpdateDisplayName(roomID, name)
+    if _, _, err := s.authorize(userID, roomID, PermRename); err != nil {
+        return err
+    }
+    // 公開チャンネルは他のチャンネルと同じ名前にできない
+    err := s.rRepo.UpdateDisplayName(roomID, name)
+    if errors.Is(err, repository.ErrDuplicateChannelName) {
+        return ErrChannelNameTaken
+    }
+    return err
+}
+
+// 同じルームの他のメンバー（オンライン状態の通知先）
+func (s *RoomService) GetCoMemberIDs(userID uint) ([]uint, error) {
+    return s.rRepo.GetCoMemberIDs(userID)
 }
 
 // ルームメンバー取得
@@ -166,12 +312,430 @@ func (s *RoomService) GetMembersByRoomID(roomID string) ([]dto.UserSummary, erro
 	return s.rRepo.GetRoomMembers(roomID)
 }
 
-// グループ退会
-func (s *RoomService) LeaveRoom(roomID string, userID uint) error {
-	return s.rRepo.RemoveMember(roomID, userID)
+// グループ退会（owner が抜けたら残ったメンバーを昇格し、その変更を返す）
+// メンバーでなければ ErrMemberNotFound
+func (s *RoomService) LeaveRoom(roomID string, userID uint) (*RoleChange, error) {
+	member, err := s.rRepo.FindMembership(roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrMemberNotFound
+	}
+
+	promotedID, err := s.removeMember(roomID, userID, nil)
+	if err != nil || promotedID == 0 {
+		return nil, err
+	}
+	return &RoleChange{RoomID: roomID, UserID: promotedID, Role: model.RoomRoleOwner}, nil
+}
+
+// メンバーを削除（確認の後に抜けていれば ErrMemberNotFound）
+func (s *RoomService) removeMember(roomID string, userID uint, msg *model.Message) (uint, error) {
+	promotedID, err := s.rRepo.RemoveMember(roomID, userID, msg)
+	if errors.Is(err, repository.ErrNotMember) {
+		return 0, ErrMemberNotFound
+	}
+	return promotedID, err
+}
+
+var (
+	ErrNotGroupRoom   = errors.New("room is not a group")
+	ErrMemberNotFound = errors.New("user is not a member of room")
+	ErrInvalidMembers = errors.New("invalid user_ids")
+	ErrRemoveSelf     = errors.New("cannot remove yourself; leave the room instead")
+	ErrRoomExists     = errors.New("one-to-one room already exists")
+)
+
+// メンバーの追加・削除の結果
+type MembershipChange struct {
+	RoomID  string            `json:"room_id"`
+	ActorID uint              `json:"actor_id"` // 追加・削除したユーザー
+	Users   []dto.UserSummary `json:"users"`    // 追加・削除されたユーザー
+
+	Message *model.Message `json:"-"` // ルームに記録したシステムメッセージ（変更がなければ nil）
+}
+
+// グループにメンバーを追加（既にメンバーのユーザーは飛ばす）
+func (s *RoomService) AddMembers(actorID uint, actorName string, roomID uuid.UUID, userIDs []uint) (*MembershipChange, error) {
+	if _, _, err := s.authorize(actorID, roomID.String(), PermAddMembers); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(userIDs))
+	seen := make(map[uint]bool, len(userIDs))
+	for _, id := range userIDs {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, ErrInvalidMembers
+	}
+	users, err := s.uRepo.GetUsersByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) != len(ids) {
+		return nil, ErrInvalidMembers
+	}
+
+	change := &MembershipChange{RoomID: roomID.String(), ActorID: actorID, Users: []dto.UserSummary{}}
+	var addedIDs []uint
+	var names []string
+	for _, u := range users {
+		ok, err := s.rRepo.InUserInRoom(u.ID, roomID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			continue
+		}
+		addedIDs = append(addedIDs, u.ID)
+		names = append(names, u.Name)
+		change.Users = append(change.Users, dto.UserSummary{ID: u.ID, Name: u.Name})
+	}
+	if len(addedIDs) == 0 {
+		return change, nil
+	}
+
+	msg := newSystemMessage(roomID, actorID, actorName, fmt.Sprintf("%s が %s を追加しました", actorName, strings.Join(names, "、")))
+	if err := s.rRepo.AddMembers(roomID.String(), addedIDs, msg); err != nil {
+		return nil, err
+	}
+	change.Message = msg
+	return change, nil
+}
+
+// グループからメンバーを削除（自分自身は退会で行う）
+// 削除できるのは自分より弱い役割のメンバーだけ
+func (s *RoomService) RemoveMember(actorID uint, actorName string, roomID uuid.UUID, userID uint) (*MembershipChange, error) {
+	_, actor, err := s.authorize(actorID, roomID.String(), PermRemoveMembers)
+	if err != nil {
+		return nil, err
+	}
+	if userID == actorID {
+		return nil, ErrRemoveSelf
+	}
+
+	target, err := s.rRepo.FindMembership(roomID.String(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, ErrMemberNotFound
+	}
+	if roleRank[target.Role] >= roleRank[actor.Role] {
+		return nil, ErrPermissionDenied
+	}
+	user, err := s.uRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := newSystemMessage(roomID, actorID, actorName, fmt.Sprintf("%s が %s を削除しました", actorName, user.Name))
+	// 削除する側が残るので owner の昇格は起きない
+	if _, err := s.removeMember(roomID.String(), userID, msg); err != nil {
+		return nil, err
+	}
+	return &MembershipChange{
+		RoomID:  roomID.String(),
+		ActorID: actorID,
+		Users:   []dto.UserSummary{{ID: user.ID, Name: user.Name}},
+		Message: msg,
+	}, nil
+}
+
+// メンバー変更などを記録するシステムメッセージ（送信者は操作したユーザー）
+func newSystemMessage(roomID uuid.UUID, actorID uint, actorName string, content string) *model.Message {
+	return &model.Message{
+		RoomID:    roomID,
+		SenderID:  actorID,
+		Sender:    actorName,
+		Content:   content,
+		Kind:      model.MessageKindSystem,
+		CreatedAt: time.Now(),
+	}
 }
 
 // グループ削除
-func (s *RoomService) DeleteRoom(roomID string) error {
+func (s *RoomService) DeleteRoom(userID uint, roomID string) error {
+	if _, _, err := s.authorize(userID, roomID, PermDelete); err != nil {
+		return err
+	}
 	return s.rRepo.DeleteRoom(roomID)
 }
+
+// 役割の変更
+type RoleChange struct {
+	RoomID  string `json:"room_id"`
+	UserID  uint   `json:"user_id"`
+	Role    string `json:"role"`
+	ActorID uint   `json:"actor_id,omitempty"` // 退会による自動昇格なら 0
+}
+
+// admin の任命・解任（owner のみ。owner の付け替えは TransferOwnership で行う）
+func (s *RoomService) ChangeRole(actorID uint, roomID uuid.UUID, userID uint, role string) (*RoleChange, error) {
+	if role != model.RoomRoleAdmin && role != model.RoomRoleMember {
+		return nil, ErrInvalidRole
+	}
+	if _, _, err := s.authorize(actorID, roomID.String(), PermManageRoles); err != nil {
+		return nil, err
+	}
+	if userID == actorID {
+		return nil, ErrInvalidRole
+	}
+
+	target, err := s.rRepo.FindMembership(roomID.String(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, ErrMemberNotFound
+	}
+	if target.Role != role {
+		if err := s.rRepo.SetMemberRole(roomID.String(), userID, role); err != nil {
+			return nil, err
+		}
+	}
+	return &RoleChange{RoomID: roomID.String(), UserID: userID, Role: role, ActorID: actorID}, nil
+}
+
+// owner を他のメンバーに譲る（自分は admin になる）
+func (s *RoomService) TransferOwnership(actorID uint, roomID uuid.UUID, userID uint) ([]RoleChange, error) {
+	if _, _, err := s.authorize(actorID, roomID.String(), PermManageRoles); err != nil {
+		return nil, err
+	}
+	if userID == actorID {
+		return nil, ErrInvalidRole
+	}
+
+	target, err := s.rRepo.FindMembership(roomID.String(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, ErrMemberNotFound
+	}
+	if err := s.rRepo.TransferOwnership(roomID.String(), actorID, userID); err != nil {
+		return nil, err
+	}
+	return []RoleChange{
+		{RoomID: roomID.String(), UserID: userID, Role: model.RoomRoleOwner, ActorID: actorID},
+		{RoomID: roomID.String(), UserID: actorID, Role: model.RoomRoleAdmin, ActorID: actorID},
+	}, nil
+}
+
+// ピン留めの変更
+type PinChange struct {
+	RoomID    string    `json:"room_id"`
+	MessageID uint      `json:"message_id"`
+	Pinned    bool      `json:"pinned"`
+	ActorID   uint      `json:"actor_id"`
+	At        time.Time `json:"at"`
+}
+
+// メッセージをピン留め（済みなら変更なしで nil）
+func (s *RoomService) PinMessage(userID uint, roomID uuid.UUID, messageID uint) (*PinChange, error) {
+	return s.setPinned(userID, roomID, messageID, true)
+}
+
+// ピン留めを外す（されていなければ変更なしで nil）
+func (s *RoomService) UnpinMessage(userID uint, roomID uuid.UUID, messageID uint) (*PinChange, error) {
+	return s.setPinned(userID, roomID, messageID, false)
+}
+
+func (s *RoomService) setPinned(userID uint, roomID uuid.UUID, messageID uint, pinned bool) (*PinChange, error) {
+	if _, _, err := s.authorize(userID, roomID.String(), PermPin); err != nil {
+		return nil, err
+	}
+	ok, err := s.rRepo.MessageInRoom(messageID, roomID.String())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+
+	now := time.Now()
+	var changed bool
+	if pinned {
+		changed, err = s.rRepo.PinMessage(roomID.String(), messageID, userID, now)
+	} else {
+		changed, err = s.rRepo.UnpinMessage(roomID.String(), messageID)
+	}
+	if err != nil || !changed {
+		return nil, err
+	}
+	return &PinChange{RoomID: roomID.String(), MessageID: messageID, Pinned: pinned, ActorID: userID, At: now}, nil
+}
+
+// ピン留めしたメッセージ一覧（メンバーのみ）
+func (s *RoomService) GetPinnedMessages(userID uint, roomID uuid.UUID) ([]dto.PinnedMessage, error) {
+	ok, err := s.rRepo.InUserInRoom(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRoomAccessDenied
+	}
+	return s.rRepo.GetPinnedMessages(roomID.String())
+}
+
+var (
+	ErrInvalidChannel   = errors.New("invalid channel name, topic or description")
+	ErrChannelNameTaken = errors.New("channel name is already taken")
+	ErrNotPublicChannel = errors.New("room is not a public channel")
+)
+
+// チャンネル名・トピック・説明の長さ（文字数）
+const (
+	maxChannelNameLength        = 80
+	maxChannelTopicLength       = 250
+	maxChannelDescriptionLength = 1000
+
+	// チャンネル一覧の1ページの件数（既定・上限）
+	defaultChannelPageSize = 30
+	maxChannelPageSize     = 100
+)
+
+// 公開チャンネルを作成（作成者が owner）
+func (s *RoomService) CreateChannel(creatorID uint, displayName string, topic string, description string) (*model.Room, error) {
+	displayName = strings.TrimSpace(displayName)
+	if displayName == "" || utf8.RuneCountInString(displayName) > maxChannelNameLength {
+		return nil, ErrInvalidChannel
+	}
+	if err := validateChannelInfo(topic, description); err != nil {
+		return nil, err
+	}
+
+	exists, err := s.rRepo.PublicChannelNameExists(displayName)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrChannelNameTaken
+	}
+
+	room := &model.Room{
+		ID:          uuid.New(),
+		IsGroup:     true,
+		Name:        "channel_" + uuid.NewString(), // メンバーで探さないので固有のキー
+		DisplayName: displayName,
+		Visibility:  model.RoomVisibilityPublic,
+		Topic:       topic,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
+	// 確認の後に同じ名前で作られていれば一意制約で失敗する
+	err = s.rRepo.CreateRoom(room, []uint{creatorID}, creatorID)
+	if errors.Is(err, repository.ErrDuplicateChannelName) {
+		return nil, ErrChannelNameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// 公開チャンネルの一覧（query で名前・トピック・説明を部分一致検索）
+func (s *RoomService) ListChannels(userID uint, query string, limit int, offset int) ([]dto.ChannelSummary, error) {
+	if limit <= 0 {
+		limit = defaultChannelPageSize
+	}
+	limit = min(limit, maxChannelPageSize)
+	offset = max(offset, 0)
+	return s.rRepo.ListPublicChannels(userID, strings.TrimSpace(query), limit, offset)
+}
+
+// 公開チャンネルに参加（参加済みなら Message が nil の結果を返す）
+func (s *RoomService) JoinChannel(userID uint, userName string, roomID uuid.UUID) (*MembershipChange, error) {
+	if _, err := s.findPublicChannel(roomID); err != nil {
+		return nil, err
+	}
+
+	change := &MembershipChange{
+		RoomID:  roomID.String(),
+		ActorID: userID,
+		Users:   []dto.UserSummary{{ID: userID, Name: userName}},
+	}
+	ok, err := s.rRepo.InUserInRoom(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return change, nil
+	}
+
+	msg := newSystemMessage(roomID, userID, userName, fmt.Sprintf("%s が参加しました", userName))
+	if err := s.rRepo.AddMembers(roomID.String(), []uint{userID}, msg); err != nil {
+		return nil, err
+	}
+	change.Message = msg
+	return change, nil
+}
+
+// 公開チャンネルから退出（owner が抜けたら残ったメンバーを昇格し、その変更も返す）
+func (s *RoomService) LeaveChannel(userID uint, userName string, roomID uuid.UUID) (*MembershipChange, *RoleChange, error) {
+	if _, err := s.findPublicChannel(roomID); err != nil {
+		return nil, nil, err
+	}
+	ok, err := s.rRepo.InUserInRoom(userID, roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, ErrMemberNotFound
+	}
+
+	msg := newSystemMessage(roomID, userID, userName, fmt.Sprintf("%s が退出しました", userName))
+	promotedID, err := s.removeMember(roomID.String(), userID, msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	change := &MembershipChange{
+		RoomID:  roomID.String(),
+		ActorID: userID,
+		Users:   []dto.UserSummary{{ID: userID, Name: userName}},
+		Message: msg,
+	}
+	var promoted *RoleChange
+	if promotedID != 0 {
+		promoted = &RoleChange{RoomID: roomID.String(), UserID: promotedID, Role: model.RoomRoleOwner}
+	}
+	return change, promoted, nil
+}
+
+// チャンネルのトピックと説明を変更（owner / admin のみ）
+func (s *RoomService) UpdateChannelInfo(userID uint, roomID uuid.UUID, topic string, description string) (*model.Room, error) {
+	if _, _, err := s.authorize(userID, roomID.String(), PermEditInfo); err != nil {
+		return nil, err
+	}
+	if err := validateChannelInfo(topic, description); err != nil {
+		return nil, err
+	}
+	if err := s.rRepo.UpdateChannelInfo(roomID.String(), topic, description); err != nil {
+		return nil, err
+	}
+	return s.rRepo.FindRoomByID(roomID.String())
+}
+
+func (s *RoomService) findPublicChannel(roomID uuid.UUID) (*model.Room, error) {
+	room, err := s.rRepo.FindRoomByID(roomID.String())
+	if err != nil {
+		return nil, err
+	}
+	if room == nil || room.Visibility != model.RoomVisibilityPublic {
+		return nil, ErrNotPublicChannel
+	}
+	return room, nil
+}
+
+func validateChannelInfo(topic string, description string) error {
+	if utf8.RuneCountInString(topic) > maxChannelTopicLength || utf8.RuneCountInString(description) > maxChannelDescriptionLength {
+		return ErrInvalidChannel
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package service_test
+
+import (
+	"chat-app/internal/model"
+	"chat-app/internal/repository"
+	"chat-app/internal/service"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TEST_DB_URL（マイグレーション済みのデータベース）に接続できなければスキップ
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_URL")
+	if dsn == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Skipf("database is not available: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Skipf("database is not available: %v", err)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		t.Skipf("database is not available: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// テスト用のユーザーを作成（終了時に削除）
+func createUsers(t *testing.T, db *gorm.DB, n int) []model.User {
+	t.Helper()
+	repo := repository.NewUserRepository(db)
+	users := make([]model.User, n)
+	for i := range users {
+		users[i] = model.User{
+			Name:     "test-" + uuid.NewString()[:8],
+			Email:    "test-" + uuid.NewString() + "@example.com",
+			Password: "x",
+		}
+		if err := repo.Create(&users[i]); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, u := range users {
+			db.Delete(&model.User{}, u.ID)
+		}
+	})
+	return users
+}
+
+// テストで作ったルームを終了時に削除（メンバー・メッセージは連鎖して消える）
+func cleanupRoom(t *testing.T, db *gorm.DB, roomID uuid.UUID) {
+	t.Cleanup(func() { db.Delete(&model.Room{}, "id = ?", roomID) })
+}
+
+func newRoomService(db *gorm.DB) (*service.RoomService, *repository.RoomRepository) {
+	roomRepo := repository.NewRoomRepository(db)
+	return service.NewRoomService(roomRepo, repository.NewUserRepository(db)), roomRepo
+}
+
+// ルーム内の各メンバーの役割
+func memberRoles(t *testing.T, db *gorm.DB, roomID uuid.UUID) map[uint]string {
+	t.Helper()
+	var members []model.RoomMember
+	if err := db.Where("room_id = ?", roomID).Find(&members).Error; err != nil {
+		t.Fatalf("find members: %v", err)
+	}
+	roles := make(map[uint]string, len(members))
+	for _, m := range members {
+		roles[m.UserID] = m.Role
+	}
+	return roles
+}
+
+func findRoom(t *testing.T, repo *repository.RoomRepository, roomID uuid.UUID) *model.Room {
+	t.Helper()
+	room, err := repo.FindRoomByID(roomID.String())
+	if err != nil || room == nil {
+		t.Fatalf("find room %s: %v", roomID, err)
+	}
+	return room
+}
+
+// 同じメンバーでも、グループは作るたびに別のルームになる
+func TestCreateGroupRoomTwiceCreatesDistinctRooms(t *testing.T) {
+	db := newTestDB(t)
+	svc, repo := newRoomService(db)
+	users := createUsers(t, db, 3)
+
+	first, err := svc.CreateGroupRoom(users[0].ID, []uint{users[1].ID, users[2].ID}, "project X")
+	if err != nil {
+		t.Fatalf("create first group: %v", err)
+	}
+	cleanupRoom(t, db, first)
+	second, err := svc.CreateGroupRoom(users[0].ID, []uint{users[2].ID, users[1].ID}, "project X")
+	if err != nil {
+		t.Fatalf("create second group: %v", err)
+	}
+	cleanupRoom(t, db, second)
+
+	if first == second {
+		t.Fatalf("got the same room %s for both groups", first)
+	}
+	if a, b := findRoom(t, repo, first).Name, findRoom(t, repo, second).Name; a == b {
+		t.Fatalf("groups share the key %q", a)
+	}
+}
+
+// owner が退会すると残ったメンバーが owner になり、追加し直しても内部キーは変わらない
+func TestLeaveAndRejoinKeepsRoomKey(t *testing.T) {
+	db := newTestDB(t)
+	svc, repo := newRoomService(db)
+	users := createUsers(t, db, 3)
+	owner, admin, member := users[0], users[1], users[2]
+
+	roomID, err := svc.CreateGroupRoom(owner.ID, []uint{member.ID, admin.ID}, "team")
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	cleanupRoom(t, db, roomID)
+	key := findRoom(t, repo, roomID).Name
+
+	if _, err := svc.ChangeRole(owner.ID, roomID, admin.ID, model.RoomRoleAdmin); err != nil {
+		t.Fatalf("promote admin: %v", err)
+	}
+
+	// admin が member より優先して owner になる
+	promoted, err := svc.LeaveRoom(roomID.String(), owner.ID)
+	if err != nil {
+		t.Fatalf("leave: %v", err)
+	}
+	if promoted == nil || promoted.UserID != admin.ID {
+		t.Fatalf("promoted = %+v, want user %d", promoted, admin.ID)
+	}
+	if got := findRoom(t, repo, roomID).Name; got != key {
+		t.Fatalf("key changed on leave: %q → %q", key, got)
+	}
+
+	change, err := svc.AddMembers(admin.ID, admin.Name, roomID, []uint{owner.ID})
+	if err != nil {
+		t.Fatalf("re-add: %v", err)
+	}
+	if len(change.Users) != 1 || change.Users[0].ID != owner.ID {
+		t.Fatalf("added users = %+v", change.Users)
+	}
+	if got := findRoom(t, repo, roomID).Name; got != key {
+		t.Fatalf("key changed on rejoin: %q → %q", key, got)
+	}
+
+	roles := memberRoles(t, db, roomID)
+	want := map[uint]string{
+		owner.ID:  model.RoomRoleMember,
+		admin.ID:  model.RoomRoleOwner,
+		member.ID: model.RoomRoleMember,
+	}
+	for id, role := range want {
+		if roles[id] != role {
+			t.Errorf("user %d role = %q, want %q", id, roles[id], role)
+		}
+	}
+
+	// owner がいる間は、誰かが抜けても昇格は起きない
+	promoted, err = svc.LeaveRoom(roomID.String(), member.ID)
+	if err != nil {
+		t.Fatalf("leave member: %v", err)
+	}
+	if promoted != nil {
+		t.Fatalf("unexpected promotion %+v", promoted)
+	}
+}
+
+// 1対1は既存のルームを再利用し、再利用しない指定なら ErrRoomExists
+func TestCreateOneToOneRoomReuse(t *testing.T) {
+	db := newTestDB(t)
+	svc, _ := newRoomService(db)
+	users := createUsers(t, db, 2)
+
+	roomID, err := svc.CreateOneToOneRoomIfNotExists(users[0].ID, users[1].ID, false)
+	if err != nil {
+		t.Fatalf("create 1:1: %v", err)
+	}
+	cleanupRoom(t, db, roomID)
+
+	again, err := svc.CreateOneToOneRoomIfNotExists(users[1].ID, users[0].ID, true)
+	if err != nil || again != roomID {
+		t.Fatalf("reuse = %s, %v; want %s", again, err, roomID)
+	}
+
+	existing, err := svc.CreateOneToOneRoomIfNotExists(users[0].ID, users[1].ID, false)
+	if !errors.Is(err, service.ErrRoomExists) {
+		t.Fatalf("err = %v, want ErrRoomExists", err)
+	}
+	if existing != roomID {
+		t.Fatalf("existing = %s, want %s", existing, roomID)
+	}
+}
+
+// 公開チャンネルを既存のチャンネルと同じ名前に変えると ErrChannelNameTaken
+func TestRenameChannelToTakenName(t *testing.T) {
+	db := newTestDB(t)
+	svc, _ := newRoomService(db)
+	users := createUsers(t, db, 1)
+	name := "channel-" + uuid.NewString()[:8]
+
+	first, err := svc.CreateChannel(users[0].ID, name, "", "")
+	if err != nil {
+		t.Fatalf("create first channel: %v", err)
+	}
+	cleanupRoom(t, db, first.ID)
+	second, err := svc.CreateChannel(users[0].ID, name+"-2", "", "")
+	if err != nil {
+		t.Fatalf("create second channel: %v", err)
+	}
+	cleanupRoom(t, db, second.ID)
+
+	if _, err := svc.CreateChannel(users[0].ID, name, "", ""); !errors.Is(err, service.ErrChannelNameTaken) {
+		t.Fatalf("create duplicate: err = %v, want ErrChannelNameTaken", err)
+	}
+	if err := svc.UpdateRoomName(users[0].ID, second.ID.String(), name); !errors.Is(err, service.ErrChannelNameTaken) {
+		t.Fatalf("rename: err = %v, want ErrChannelNameTaken", err)
+	}
+}
+
+// メンバーでないルームからは退会できず、ルームにも変化がない
+func TestLeaveRoomRequiresMembership(t *testing.T) {
+	db := newTestDB(t)
+	svc, _ := newRoomService(db)
+	users := createUsers(t, db, 3)
+	owner, outsider := users[0], users[2]
+
+	roomID, err := svc.CreateGroupRoom(owner.ID, []uint{users[1].ID}, "private")
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	cleanupRoom(t, db, roomID)
+
+	if _, err := svc.LeaveRoom(roomID.String(), outsider.ID); !errors.Is(err, service.ErrMemberNotFound) {
+		t.Fatalf("leave as outsider: err = %v, want ErrMemberNotFound", err)
+	}
+	if roles := memberRoles(t, db, roomID); len(roles) != 2 || roles[owner.ID] != model.RoomRoleOwner {
+		t.Fatalf("members changed: %+v", roles)
+	}
+}
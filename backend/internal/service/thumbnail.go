@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+const (
+	// サムネイルの長辺
+	thumbnailMaxSide = 320
+	// これを超える画像はサムネイルを作らない（展開時のメモリ対策）
+	thumbnailMaxPixels = 40_000_000
+)
+
+// サムネイル生成に対応する画像形式
+var thumbnailFormats = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// 画像を縮小したサムネイルを生成（JPEGはJPEG、それ以外はPNGで出力）
+// 戻り値: サムネイル, その Content-Type, 元画像の幅・高さ
+func generateThumbnail(r io.ReadSeeker, contentType string) ([]byte, string, int, int, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	if cfg.Width*cfg.Height > thumbnailMaxPixels {
+		return nil, "", cfg.Width, cfg.Height, nil
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", 0, 0, err
+	}
+
+	var src image.Image
+	switch contentType {
+	case "image/jpeg":
+		src, err = jpeg.Decode(r)
+	case "image/png":
+		src, err = png.Decode(r)
+	case "image/gif":
+		src, err = gif.Decode(r) // アニメーションは1枚目のみ
+	}
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+
+	thumb := resizeToFit(src, thumbnailMaxSide)
+
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+		contentType = "image/jpeg"
+	} else {
+		err = png.Encode(&buf, thumb)
+		contentType = "image/png"
+	}
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	return buf.Bytes(), contentType, cfg.Width, cfg.Height, nil
+}
+
+// 長辺が maxSide 以下になるよう縮小（エリア平均）
+func resizeToFit(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return src
+	}
+
+	dw, dh := maxSide, h*maxSide/w
+	if h > w {
+		dw, dh = w*maxSide/h, maxSide
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy0 := b.Min.Y + y*h/dh
+		sy1 := b.Min.Y + (y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			sx0 := b.Min.X + x*w/dw
+			sx1 := b.Min.X + (x+1)*w/dw
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					c := color.NRGBAModel.Convert(src.At(sx, sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n),
+				G: uint8(g / n),
+				B: uint8(bl / n),
+				A: uint8(a / n),
+			})
+		}
+	}
+	return dst
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"chat-app/internal/model"
 	"chat-app/internal/repository"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -34,3 +35,21 @@ func (s *UserService) GetUserNames(userIDs []uint) ([]string, error) {
 	}
 	return names, nil
 }
+
+// ユーザー設定取得（未設定なら既定値）
+func (s *UserService) GetSettings(userID uint) (*model.UserSetting, error) {
+	return s.Repo.GetSettings(userID)
+}
+
+// 既読を知らせるかどうかを変更
+func (s *UserService) UpdateReadReceipts(userID uint, enabled bool) (*model.UserSetting, error) {
+	settings := &model.UserSetting{
+		UserID:              userID,
+		ReadReceiptsEnabled: enabled,
+		UpdatedAt:           time.Now(),
+	}
+	if err := s.Repo.SaveSettings(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// 保存・取得・削除がひと通りでき、削除後は ErrNotFound になる
+func TestLocalStorageRoundTrip(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("new local storage: %v", err)
+	}
+	ctx := context.Background()
+	key := "attachments/room/file/original"
+	body := "hello, 添付ファイル"
+
+	if err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	rc, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(got) != body {
+		t.Fatalf("got %q, want %q", got, body)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get after delete: err = %v, want ErrNotFound", err)
+	}
+	// 既に無いものの削除はエラーにしない
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("delete again: %v", err)
+	}
+}
+
+// 保存先の外を指すキーは拒否する
+func TestLocalStorageRejectsInvalidKeys(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("new local storage: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../b", "a\\b", "a//b"} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("put %q: err = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("get %q: err = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// 署名付きダウンロードURLの有効期間
+const fileURLTTL = 15 * time.Minute
+
+// 添付ファイルの署名付きURL（/files/:id）を生成
+// variant は "original" or "thumbnail"
+func SignFileURL(fileID string, variant string) string {
+	exp := time.Now().Add(fileURLTTL).Unix()
+	q := url.Values{}
+	q.Set("variant", variant)
+	q.Set("exp", strconv.FormatInt(exp, 10))
+	q.Set("sig", fileSignature(fileID, variant, exp))
+	return "/files/" + fileID + "?" + q.Encode()
+}
+
+// 署名付きURLの検証（期限切れ・改ざんは false）
+func VerifyFileSignature(fileID string, variant string, expStr string, sig string) bool {
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	expected := fileSignature(fileID, variant, exp)
+	return hmac.Equal([]byte(expected), []byte(sig))
+}
+
+func fileSignature(fileID string, variant string, exp int64) string {
+	mac := hmac.New(sha256.New, getSecretKey())
+	fmt.Fprintf(mac, "%s|%s|%d", fileID, variant, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
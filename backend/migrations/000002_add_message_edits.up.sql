@@ -0,0 +1,12 @@
+-- メッセージ編集日時
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP;
+
+-- メッセージ編集履歴テーブル（編集前の内容を保持）
+CREATE TABLE message_edits (
+  id SERIAL PRIMARY KEY,
+  message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  content TEXT NOT NULL,
+  edited_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_message_edits_message_id ON message_edits(message_id);
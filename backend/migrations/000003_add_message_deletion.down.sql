@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS message_hides;
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_at;
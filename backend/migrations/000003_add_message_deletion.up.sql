@@ -0,0 +1,10 @@
+-- 全員から削除（トゥームストーン化）した日時
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP;
+
+-- 自分だけ非表示にしたメッセージ
+CREATE TABLE message_hides (
+  message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL,
+  hidden_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (message_id, user_id)
+);
@@ -0,0 +1,4 @@
+-- スレッド返信の親メッセージ（トップレベルのメッセージは NULL）
+ALTER TABLE messages ADD COLUMN parent_id INTEGER REFERENCES messages(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_messages_parent_id ON messages(parent_id, created_at);
@@ -0,0 +1,9 @@
+-- メッセージ内のメンション（@all の場合はメンバー全員分を登録）
+CREATE TABLE message_mentions (
+  message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL,
+  is_all BOOLEAN NOT NULL DEFAULT false,
+  PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX idx_message_mentions_user_id ON message_mentions(user_id, message_id);
@@ -0,0 +1,6 @@
+-- クライアント採番のメッセージID（再送時の重複排除用）
+ALTER TABLE messages ADD COLUMN client_id VARCHAR(64);
+
+CREATE UNIQUE INDEX idx_messages_client_id
+  ON messages (room_id, sender_id, client_id)
+  WHERE client_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_settings;
+DROP INDEX IF EXISTS idx_room_reads_room_message;
+ALTER TABLE room_reads DROP COLUMN IF EXISTS last_read_message_id;
@@ -0,0 +1,17 @@
+-- 既読位置をメッセージIDで持つ（時刻ではなく、どのメッセージまで読んだか）
+ALTER TABLE room_reads ADD COLUMN last_read_message_id INT REFERENCES messages(id) ON DELETE SET NULL;
+
+-- 既存の既読時刻から既読位置を復元
+UPDATE room_reads rr SET last_read_message_id = (
+  SELECT MAX(m.id) FROM messages m
+  WHERE m.room_id = rr.room_id AND m.created_at <= rr.last_read_at
+);
+
+CREATE INDEX idx_room_reads_room_message ON room_reads (room_id, last_read_message_id);
+
+-- ユーザーごとの設定
+CREATE TABLE user_settings (
+  user_id INT PRIMARY KEY REFERENCES members(id) ON DELETE CASCADE,
+  read_receipts_enabled BOOLEAN NOT NULL DEFAULT TRUE, -- false なら既読を他のメンバーに知らせない
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS read_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS delivered_at;
@@ -0,0 +1,11 @@
+-- 1対1ルームの配信状況（相手の端末に届いた日時・相手が読んだ日時）
+ALTER TABLE messages ADD COLUMN delivered_at TIMESTAMP;
+ALTER TABLE messages ADD COLUMN read_at TIMESTAMP;
+
+-- 既存の既読位置から既読を復元（既読なら配信済みでもある）
+UPDATE messages m SET read_at = rr.last_read_at, delivered_at = rr.last_read_at
+FROM room_reads rr
+JOIN rooms r ON r.id = rr.room_id AND r.is_group = false
+WHERE rr.room_id = m.room_id
+  AND rr.user_id <> m.sender_id
+  AND m.id <= rr.last_read_message_id;
@@ -0,0 +1,12 @@
+-- メッセージの種類（text: 通常のメッセージ、system: メンバーの追加・削除などの記録）
+ALTER TABLE messages ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'text'
+  CHECK (kind IN ('text', 'system'));
+
+-- グループの内部キーを現在のメンバーから作り直す（退会時の文字列置換で崩れたものを直す）
+UPDATE rooms r SET name = k.name
+FROM (
+  SELECT room_id, 'group_' || string_agg(user_id::text, '_' ORDER BY user_id) AS name
+  FROM room_members
+  GROUP BY room_id
+) k
+WHERE k.room_id = r.id AND r.is_group = true;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS room_pins;
+DROP INDEX IF EXISTS idx_room_members_owner;
+ALTER TABLE room_members DROP COLUMN IF EXISTS joined_at;
+ALTER TABLE room_members DROP COLUMN IF EXISTS role;
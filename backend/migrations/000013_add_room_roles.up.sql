@@ -0,0 +1,30 @@
+-- ルーム内の役割（owner: 作成者、admin: 管理者、member: 一般）と参加日時
+ALTER TABLE room_members ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'member'
+  CHECK (role IN ('owner', 'admin', 'member'));
+ALTER TABLE room_members ADD COLUMN joined_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+-- 既存のグループは作成者の記録がないので、最初にメッセージを送ったメンバー（いなければIDが最小のメンバー）を owner にする
+UPDATE room_members rm SET role = 'owner'
+FROM (
+  SELECT DISTINCT ON (rm2.room_id) rm2.room_id, rm2.user_id
+  FROM room_members rm2
+  JOIN rooms r ON r.id = rm2.room_id AND r.is_group = true
+  LEFT JOIN LATERAL (
+    SELECT MIN(m.id) AS first_id FROM messages m
+    WHERE m.room_id = rm2.room_id AND m.sender_id = rm2.user_id
+  ) f ON true
+  ORDER BY rm2.room_id, f.first_id ASC NULLS LAST, rm2.user_id ASC
+) o
+WHERE rm.room_id = o.room_id AND rm.user_id = o.user_id;
+
+-- グループの owner は1人だけ
+CREATE UNIQUE INDEX idx_room_members_owner ON room_members (room_id) WHERE role = 'owner';
+
+-- ピン留めしたメッセージ
+CREATE TABLE room_pins (
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  pinned_by INTEGER NOT NULL,
+  pinned_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (room_id, message_id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS room_invite_uses;
+DROP TABLE IF EXISTS room_invites;
@@ -0,0 +1,22 @@
+-- グループの招待リンク
+CREATE TABLE room_invites (
+  id SERIAL PRIMARY KEY,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  token VARCHAR(64) NOT NULL UNIQUE,
+  created_by INTEGER NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMP,           -- null なら無期限
+  max_uses INTEGER,               -- null なら回数無制限
+  use_count INTEGER NOT NULL DEFAULT 0,
+  revoked_at TIMESTAMP            -- 取り消した日時
+);
+
+CREATE INDEX idx_room_invites_room ON room_invites (room_id, created_at DESC);
+
+-- 招待リンクから参加したユーザーの記録
+CREATE TABLE room_invite_uses (
+  invite_id INTEGER NOT NULL REFERENCES room_invites(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL,
+  joined_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (invite_id, user_id)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_rooms_public_name;
+ALTER TABLE rooms DROP COLUMN IF EXISTS description;
+ALTER TABLE rooms DROP COLUMN IF EXISTS topic;
+ALTER TABLE rooms DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,9 @@
+-- 公開範囲（private: メンバーのみ、public: 誰でも一覧から参加できるチャンネル）
+ALTER TABLE rooms ADD COLUMN visibility VARCHAR(16) NOT NULL DEFAULT 'private'
+  CHECK (visibility IN ('private', 'public'));
+-- チャンネルのトピックと説明
+ALTER TABLE rooms ADD COLUMN topic TEXT NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN description TEXT NOT NULL DEFAULT '';
+
+-- 公開チャンネル名は重複させない（大文字小文字は区別しない）
+CREATE UNIQUE INDEX idx_rooms_public_name ON rooms (lower(display_name)) WHERE visibility = 'public';
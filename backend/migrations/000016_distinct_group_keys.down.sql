@@ -0,0 +1,8 @@
+-- グループの内部キーを現在のメンバーから作り直す
+UPDATE rooms r SET name = k.name
+FROM (
+  SELECT room_id, 'group_' || string_agg(user_id::text, '_' ORDER BY user_id) AS name
+  FROM room_members
+  GROUP BY room_id
+) k
+WHERE k.room_id = r.id AND r.is_group = true AND r.visibility = 'private';
@@ -0,0 +1,4 @@
+-- グループの内部キーをメンバー構成から切り離し、ルームごとに一意にする
+-- （同じメンバーで複数のグループを作れるようにする）
+UPDATE rooms SET name = 'group_' || id::text
+WHERE is_group = true AND visibility = 'private';
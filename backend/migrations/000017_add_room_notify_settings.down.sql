@@ -0,0 +1,3 @@
+ALTER TABLE room_members
+  DROP COLUMN IF EXISTS muted_until,
+  DROP COLUMN IF EXISTS notify_level;
@@ -0,0 +1,6 @@
+-- ルームごとの通知設定（all: すべて、mentions: メンションのみ、muted: ミュート）
+-- muted_until があればその時刻までのミュート（過ぎたら all として扱う）
+ALTER TABLE room_members
+  ADD COLUMN notify_level VARCHAR(16) NOT NULL DEFAULT 'all'
+    CHECK (notify_level IN ('all', 'mentions', 'muted')),
+  ADD COLUMN muted_until TIMESTAMPTZ;
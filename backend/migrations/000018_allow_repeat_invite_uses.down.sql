@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_room_invite_uses_invite;
+
+-- 同じユーザーの記録は最新の1件だけ残す
+DELETE FROM room_invite_uses a
+USING room_invite_uses b
+WHERE a.invite_id = b.invite_id AND a.user_id = b.user_id AND a.id < b.id;
+
+ALTER TABLE room_invite_uses DROP COLUMN id;
+ALTER TABLE room_invite_uses ADD PRIMARY KEY (invite_id, user_id);
@@ -0,0 +1,5 @@
+-- 同じ招待で退会・再参加できるよう、参加の記録に独自のIDを持たせる
+ALTER TABLE room_invite_uses DROP CONSTRAINT room_invite_uses_pkey;
+ALTER TABLE room_invite_uses ADD COLUMN id SERIAL PRIMARY KEY;
+
+CREATE INDEX idx_room_invite_uses_invite ON room_invite_uses (invite_id, joined_at DESC);
@@ -0,0 +1,2 @@
+-- 拡張は他で使われている可能性があるため残す
+DROP INDEX IF EXISTS idx_messages_content_trgm;
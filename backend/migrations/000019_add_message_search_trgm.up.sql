@@ -0,0 +1,10 @@
+-- 日本語など空白で区切らない言語は to_tsvector('simple') では単語に分かれず、
+-- 文中の語で全文検索にヒットしない。部分一致（ILIKE）を併用し、その索引に pg_trgm を使う
+-- 制限:
+--   * 3文字未満の語は索引を使えず、対象の行を順に調べる（結果は正しいが遅い）
+--   * 日本語の文字をトライグラムに分けるには、データベースのロケールが C 以外（UTF-8）である必要がある
+--   * 日本語の短い語が多い場合は pg_bigm（2文字単位）の方が向いているが、使えない環境が多いため採用しない
+--   * 部分一致でヒットした語はスニペットで強調されない
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_messages_content_trgm ON messages USING GIN (content gin_trgm_ops);